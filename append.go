@@ -0,0 +1,98 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"time"
+
+	imap "github.com/emersion/go-imap"
+)
+
+// sentNamePattern matches common names of the sent mailbox, used if the
+// server does not support SPECIAL-USE and the provider profile is unknown
+var sentNamePattern = regexp.MustCompile(`(?i)^(.*[/.])?sent( items| mail| messages)?$`)
+
+// AppendMessage uploads a raw RFC 5322 message to a box, such as Inbox or
+// MailBox("Archive"), zero date means the server receiving time
+func (r Retriever) AppendMessage(box MailBox, flags []string, date time.Time,
+	raw []byte) error {
+	return r.appendMessage(r.mailboxName(box), flags, date, raw)
+}
+
+func (r Retriever) appendMessage(mailbox string, flags []string, date time.Time,
+	raw []byte) error {
+	for _, flag := range flags {
+		if !isValidFlag(flag) {
+			return fmt.Errorf("invalid flag %q", flag)
+		}
+	}
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := cli.Append(mailbox, flags, date, bytes.NewBuffer(raw)); err != nil {
+		return fmt.Errorf("append to %v: %v", mailbox, err)
+	}
+	return nil
+}
+
+// SentMailbox returns the name of the mailbox that keeps sent messages:
+// the mailbox with the SPECIAL-USE attribute \Sent, or the provider's
+// Folders.Sent that exists, or a mailbox named like "Sent" or "Sent Items"
+func (r Retriever) SentMailbox() (string, error) {
+	infos, err := r.listMailboxInfos()
+	if err != nil {
+		return "", err
+	}
+	for _, info := range infos {
+		for _, attr := range info.Attributes {
+			if attr == imap.SentAttr {
+				return info.Name, nil
+			}
+		}
+	}
+	for _, profile := range profilesForIMAP(r.providerAddrIMAP) {
+		for _, info := range infos {
+			if info.Name == profile.Folders.Sent {
+				return info.Name, nil
+			}
+		}
+	}
+	for _, info := range infos {
+		if sentNamePattern.MatchString(info.Name) {
+			return info.Name, nil
+		}
+	}
+	return "", fmt.Errorf("sent mailbox not found")
+}
+
+// AppendSent uploads a sent message to the SentMailbox, marked as read
+func (r Retriever) AppendSent(raw []byte) error {
+	mailbox, err := r.SentMailbox()
+	if err != nil {
+		return err
+	}
+	return r.appendMessage(mailbox, []string{FlagSeen}, time.Now(), raw)
+}
+
+// WithSentCopy makes the Sender upload each sent message to the Sent
+// mailbox of the retriever's account, because some providers do not keep
+// a copy of messages sent over SMTP, if the upload fails SendMail returns
+// a SentCopyError (the message was sent)
+func WithSentCopy(retriever *Retriever) SenderOption {
+	return func(s *Sender) { s.sentCopy = retriever }
+}
+
+// SentCopyError means the message was sent but was not copied to the
+// Sent mailbox, it must not be sent again
+type SentCopyError struct {
+	Err error
+}
+
+func (e *SentCopyError) Error() string {
+	return fmt.Sprintf("sent but not copied to sent mailbox: %v", e.Err)
+}
+
+func (e *SentCopyError) Unwrap() error { return e.Err }
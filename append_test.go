@@ -0,0 +1,84 @@
+package email
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+)
+
+func TestSender_WithSentCopy(t *testing.T) {
+	imapServer := newFakeIMAPServer(t)
+	r := imapServer.retriever(t)
+	smtpServer := newFakeSMTPServer(t, nil)
+	sender := smtpServer.sender()
+	WithSentCopy(r)(&sender)
+
+	err := sender.SendMail("friend@example.com", "lunch", TextPlain, "at noon")
+	var copyErr *SentCopyError
+	if !errors.As(err, &copyErr) {
+		t.Fatalf("expected SentCopyError without a sent mailbox, got %v", err)
+	}
+
+	if err := r.CreateMailbox("Sent Items"); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := r.SentMailbox(); err != nil || name != "Sent Items" {
+		t.Fatalf("unexpected SentMailbox: %v, %v", name, err)
+	}
+	if err := sender.SendMail("friend@example.com", "dinner", TextPlain, "at 7pm"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AppendMessage(MailBox("Sent Items"), nil, time.Now(),
+		[]byte("Subject: imported\r\n\r\nold mail")); err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := imapServer.user.GetMailbox("Sent Items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := box.(*memory.Mailbox).Messages
+	if len(stored) != 2 {
+		t.Fatalf("unexpected number of messages in sent mailbox: %v", len(stored))
+	}
+	received := smtpServer.receivedMessages()
+	// the DATA terminator adds a CRLF if the message does not end with one
+	sent := strings.TrimSuffix(string(received[len(received)-1]), "\r\n")
+	if string(stored[0].Body) != sent {
+		t.Errorf("sent copy differs from sent message:\n%s\n%s", stored[0].Body, sent)
+	}
+	if len(stored[0].Flags) != 1 || stored[0].Flags[0] != FlagSeen {
+		t.Errorf("unexpected sent copy flags: %v", stored[0].Flags)
+	}
+	if !strings.Contains(string(stored[1].Body), "old mail") {
+		t.Errorf("unexpected appended message: %s", stored[1].Body)
+	}
+}
+
+func TestRetriever_AppendConcurrently(t *testing.T) {
+	imapServer := newFakeIMAPServer(t)
+	r := imapServer.retriever(t)
+	if err := r.CreateMailbox("Sent"); err != nil {
+		t.Fatal(err)
+	}
+	// a Queue with several workers over a Sender WithSentCopy
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- r.AppendSent([]byte("Subject: sent\r\n\r\nbody")) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	box, err := imapServer.user.GetMailbox("Sent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(box.(*memory.Mailbox).Messages); n != cap(errs) {
+		t.Errorf("unexpected number of sent copies: real %v, expected %v", n, cap(errs))
+	}
+}
@@ -0,0 +1,374 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exportBatchSize is the number of messages downloaded at once by
+// ExportMessages, so a big mailbox is not held in memory
+const exportBatchSize = 100
+
+// MessageWriter is a destination of ExportMessages, such as MboxWriter or
+// MaildirWriter, the messages must have Raw bytes
+type MessageWriter interface {
+	WriteMessage(msg Message) error
+}
+
+// MessageReader is a source of ImportMessages, such as MboxReader or
+// MaildirReader, ReadMessage returns io.EOF after the last message
+type MessageReader interface {
+	ReadMessage() (Message, error)
+}
+
+// ExportMessages downloads the messages that match the filter from a
+// retrieved box (Inbox or Spam) in UID order and writes them to w,
+// returns the number of written messages
+func (r Retriever) ExportMessages(box MailBox, filter SearchCriteria,
+	w MessageWriter) (int, error) {
+	uids, err := r.searchUIDs(box, filter)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(uids, func(i int, j int) bool { return uids[i] < uids[j] })
+	written := 0
+	for start := 0; start < len(uids); start += exportBatchSize {
+		end := start + exportBatchSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+		batchFilter := filter
+		batchFilter.UIDs = uidSet(uids[start:end]).String()
+		msgs, err := r.retrieveMails(batchFilter, box, newFetchConfig(nil))
+		if err != nil {
+			return written, err
+		}
+		sort.Slice(msgs, func(i int, j int) bool { return msgs[i].UID < msgs[j].UID })
+		for _, msg := range msgs {
+			if err := w.WriteMessage(msg); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+// searchUIDs returns the UIDs of the messages in the box that match the
+// filter, in the server order
+func (r Retriever) searchUIDs(box MailBox, filter SearchCriteria) ([]uint32, error) {
+	boxClient, unlock, err := r.selectedClient(box)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if _, err := boxClient.Select(r.mailboxName(box), true); err != nil {
+		return nil, fmt.Errorf("select mail box: %v", err)
+	}
+	search, err := filter.imapCriteria(true)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := boxClient.UidSearch(search)
+	if err != nil {
+		return nil, fmt.Errorf("imap search request failed: %v", err)
+	}
+	return uids, nil
+}
+
+// ImportMessages uploads all messages from rd to a box, such as Inbox or
+// MailBox("Archive"), keeping their flags and InternalDate, the messages
+// must have Raw bytes, returns the number of uploaded messages
+func (r Retriever) ImportMessages(box MailBox, rd MessageReader) (int, error) {
+	mailbox := r.mailboxName(box)
+	imported := 0
+	for {
+		msg, err := rd.ReadMessage()
+		if err == io.EOF {
+			return imported, nil
+		}
+		if err != nil {
+			return imported, err
+		}
+		if msg.Raw() == nil {
+			return imported, fmt.Errorf("import message %v: raw message was not downloaded",
+				imported+1)
+		}
+		flags := make([]string, 0, len(msg.Flags))
+		for _, flag := range msg.Flags {
+			if flag != `\Recent` { // only the server can set \Recent
+				flags = append(flags, flag)
+			}
+		}
+		if err := r.appendMessage(mailbox, flags, msg.InternalDate, msg.Raw()); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+}
+
+// mboxDateLayout is the date format in the "From " separator lines
+const mboxDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// MboxWriter writes messages to an mbox file in mboxrd format: each message
+// starts with a "From sender date" line and body lines that start with
+// ">*From " are quoted with one more ">", flags are not kept
+type MboxWriter struct {
+	w     *bufio.Writer
+	mutex sync.Mutex
+}
+
+// NewMboxWriter returns a MboxWriter that appends messages to w
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: bufio.NewWriter(w)}
+}
+
+// WriteMessage writes a message with Raw bytes
+func (w *MboxWriter) WriteMessage(msg Message) error {
+	if msg.Raw() == nil {
+		return fmt.Errorf("raw message was not downloaded")
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	sender := msg.From
+	if sender == "" || strings.ContainsAny(sender, " \t\r\n") {
+		sender = "MAILER-DAEMON"
+	}
+	date := msg.InternalDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	fmt.Fprintf(w.w, "From %v %v\n", sender, date.UTC().Format(mboxDateLayout))
+	raw := msg.Raw()
+	for len(raw) > 0 {
+		line := raw
+		if i := bytes.IndexByte(raw, '\n'); i >= 0 {
+			line = raw[:i+1]
+		}
+		raw = raw[len(line):]
+		if isMboxFromLine(bytes.TrimLeft(line, ">")) {
+			w.w.WriteByte('>')
+		}
+		w.w.Write(line)
+		if len(raw) == 0 && line[len(line)-1] != '\n' {
+			w.w.WriteByte('\n')
+		}
+	}
+	w.w.WriteByte('\n')
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("write mbox: %v", err)
+	}
+	return nil
+}
+
+func isMboxFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+// MboxReader reads messages from an mbox file in mboxrd format, such as
+// written by MboxWriter, one ">" is removed from body lines that start with
+// ">*From ", so in a mboxo file a body line ">From " loses its ">"
+type MboxReader struct {
+	r    *bufio.Reader
+	next []byte // the "From " line of the next message
+}
+
+// NewMboxReader returns a MboxReader that reads messages from r
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{r: bufio.NewReader(r)}
+}
+
+// ReadMessage returns the next message, parsed by ParseMessage, with the
+// InternalDate from the "From " line, a malformed message is returned with
+// Message.ParseErr
+func (m *MboxReader) ReadMessage() (Message, error) {
+	for m.next == nil {
+		line, err := m.r.ReadBytes('\n')
+		if isMboxFromLine(line) {
+			m.next = line
+			break
+		}
+		if err == io.EOF {
+			return Message{}, io.EOF
+		}
+		if err != nil {
+			return Message{}, fmt.Errorf("read mbox: %v", err)
+		}
+	}
+	separator := m.next
+	m.next = nil
+	raw := &bytes.Buffer{}
+	for {
+		line, err := m.r.ReadBytes('\n')
+		if isMboxFromLine(line) {
+			m.next = line
+			break
+		}
+		if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) &&
+			isMboxFromLine(unquoted) {
+			line = line[1:]
+		}
+		raw.Write(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Message{}, fmt.Errorf("read mbox: %v", err)
+		}
+	}
+	// the empty line before the next "From " line is not a part of the message
+	data := bytes.TrimSuffix(raw.Bytes(), []byte("\n"))
+	msg, _ := ParseMessage(bytes.NewReader(data))
+	fields := strings.Fields(string(separator))
+	if len(fields) >= 3 {
+		date := strings.Join(fields[2:], " ")
+		if t, err := time.Parse(mboxDateLayout, date); err == nil {
+			msg.InternalDate = t
+		}
+	}
+	return msg, nil
+}
+
+// maildirFlags maps Maildir info letters to IMAP flags, in the
+// alphabetical order that the info must have
+var maildirFlags = []struct {
+	letter byte
+	flag   string
+}{
+	{'D', FlagDraft},
+	{'F', FlagFlagged},
+	{'R', FlagAnswered},
+	{'S', FlagSeen},
+	{'T', FlagDeleted},
+}
+
+// MaildirWriter writes each message to a file in the cur directory of a
+// Maildir, the flags are kept in the filename info, example:
+// "1623034800.7_1234.host:2,FS", the file modification time is the
+// InternalDate, keywords are not kept
+type MaildirWriter struct {
+	dir      string
+	hostname string
+	mutex    sync.Mutex
+	count    int
+}
+
+// NewMaildirWriter creates the Maildir directories tmp, new and cur in dir
+// if they do not exist
+func NewMaildirWriter(dir string) (*MaildirWriter, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, fmt.Errorf("create maildir: %v", err)
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	hostname = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(hostname)
+	return &MaildirWriter{dir: dir, hostname: hostname}, nil
+}
+
+// WriteMessage writes a message with Raw bytes, the file is written to tmp
+// then moved to cur so a reader never sees a partial message
+func (w *MaildirWriter) WriteMessage(msg Message) error {
+	if msg.Raw() == nil {
+		return fmt.Errorf("raw message was not downloaded")
+	}
+	date := msg.InternalDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	w.mutex.Lock()
+	w.count++
+	name := fmt.Sprintf("%v.%v_%v.%v", date.Unix(), w.count, os.Getpid(), w.hostname)
+	w.mutex.Unlock()
+	info := ":2,"
+	for _, f := range maildirFlags {
+		if msg.HasFlag(f.flag) {
+			info += string(f.letter)
+		}
+	}
+	tmpPath := filepath.Join(w.dir, "tmp", name)
+	if err := ioutil.WriteFile(tmpPath, msg.Raw(), 0600); err != nil {
+		return fmt.Errorf("write maildir: %v", err)
+	}
+	if err := os.Chtimes(tmpPath, date, date); err != nil {
+		return fmt.Errorf("write maildir: %v", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(w.dir, "cur", name+info)); err != nil {
+		return fmt.Errorf("write maildir: %v", err)
+	}
+	return nil
+}
+
+// MaildirReader reads the messages in the new and cur directories of a
+// Maildir, ordered by filename
+type MaildirReader struct {
+	paths []string
+}
+
+// NewMaildirReader lists the messages in dir, messages delivered later
+// are not read
+func NewMaildirReader(dir string) (*MaildirReader, error) {
+	paths := make([]string, 0)
+	for _, sub := range []string{"new", "cur"} {
+		files, err := ioutil.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, fmt.Errorf("read maildir: %v", err)
+		}
+		for _, file := range files {
+			if file.Mode().IsRegular() && !strings.HasPrefix(file.Name(), ".") {
+				paths = append(paths, filepath.Join(dir, sub, file.Name()))
+			}
+		}
+	}
+	sort.Slice(paths, func(i int, j int) bool {
+		return filepath.Base(paths[i]) < filepath.Base(paths[j])
+	})
+	return &MaildirReader{paths: paths}, nil
+}
+
+// ReadMessage returns the next message, parsed by ParseMessage, with the
+// Flags from the filename info and the InternalDate from the file
+// modification time, a malformed message is returned with Message.ParseErr
+func (m *MaildirReader) ReadMessage() (Message, error) {
+	if len(m.paths) == 0 {
+		return Message{}, io.EOF
+	}
+	path := m.paths[0]
+	m.paths = m.paths[1:]
+	file, err := os.Open(path)
+	if err != nil {
+		return Message{}, fmt.Errorf("read maildir: %v", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return Message{}, fmt.Errorf("read maildir: %v", err)
+	}
+	msg, err := ParseMessage(file)
+	if msg.Raw() == nil {
+		return Message{}, err
+	}
+	msg.InternalDate = stat.ModTime()
+	name := filepath.Base(path)
+	if i := strings.LastIndex(name, ":2,"); i >= 0 {
+		info := name[i+len(":2,"):]
+		for _, f := range maildirFlags {
+			if strings.IndexByte(info, f.letter) >= 0 {
+				msg.Flags = append(msg.Flags, f.flag)
+			}
+		}
+	}
+	return msg, nil
+}
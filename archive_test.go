@@ -0,0 +1,177 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+)
+
+// readAll reads all messages from rd
+func readAll(t *testing.T, rd MessageReader) []Message {
+	ret := make([]Message, 0)
+	for {
+		msg, err := rd.ReadMessage()
+		if err == io.EOF {
+			return ret
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, msg)
+	}
+}
+
+func TestMbox(t *testing.T) {
+	date := time.Date(2021, 6, 7, 3, 0, 0, 0, time.UTC)
+	raws := []string{
+		"From: alice@example.com\r\nSubject: a\r\n\r\nFrom now on\r\n>From here\r\n",
+		"Subject: b\r\n\r\nno trailing newline\n\nFrom",
+	}
+	archive := &bytes.Buffer{}
+	w := NewMboxWriter(archive)
+	for _, raw := range raws {
+		msg, _ := ParseMessage(strings.NewReader(raw))
+		msg.InternalDate = date
+		if err := w.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteMessage(Message{}); err == nil {
+		t.Errorf("expected error for a message without raw bytes")
+	}
+	if !strings.HasPrefix(archive.String(),
+		"From alice@example.com Mon Jun  7 03:00:00 2021\n") ||
+		!strings.Contains(archive.String(), "\r\n>From now on\r\n>>From here\r\n") {
+		t.Errorf("unexpected mbox: %q", archive.String())
+	}
+
+	msgs := readAll(t, NewMboxReader(archive))
+	if len(msgs) != 2 {
+		t.Fatalf("unexpected messages: %#v", msgs)
+	}
+	if string(msgs[0].Raw()) != raws[0] || msgs[0].Subject != "a" ||
+		!msgs[0].InternalDate.Equal(date) {
+		t.Errorf("unexpected message: %q, %#v", msgs[0].Raw(), msgs[0])
+	}
+	if string(msgs[1].Raw()) != raws[1]+"\n" {
+		t.Errorf("unexpected message: %q", msgs[1].Raw())
+	}
+}
+
+func TestMaildir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, err := NewMaildirWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2021, 6, 7, 3, 0, 0, 0, time.UTC)
+	msg, _ := ParseMessage(strings.NewReader("Subject: a\r\n\r\nhello"))
+	msg.InternalDate = date
+	msg.Flags = []string{FlagSeen, `\Recent`, FlagFlagged, "otp_used"}
+	if err := w.WriteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "cur", "*:2,FS"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("unexpected maildir files: %v, %v", files, err)
+	}
+	// a message delivered by another program
+	err = ioutil.WriteFile(filepath.Join(dir, "new", "2000000000.1.host"),
+		[]byte("Subject: b\r\n\r\nhi"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewMaildirReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := readAll(t, rd)
+	if len(msgs) != 2 {
+		t.Fatalf("unexpected messages: %#v", msgs)
+	}
+	if msgs[0].Body != "hello" || !msgs[0].InternalDate.Equal(date) ||
+		!equalFlags(msgs[0].Flags, []string{FlagFlagged, FlagSeen}) {
+		t.Errorf("unexpected message: %#v", msgs[0])
+	}
+	if msgs[1].Subject != "b" || len(msgs[1].Flags) != 0 {
+		t.Errorf("unexpected message: %#v", msgs[1])
+	}
+}
+
+func TestRetriever_ExportImport(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	date := time.Date(2021, 6, 7, 3, 0, 0, 0, time.UTC)
+	s.addMessage(t, "Spam", []string{FlagSeen}, date, "Subject: a\r\n\r\nhello")
+	s.addMessage(t, "Spam", nil, date.Add(time.Hour), testMultipartMessage)
+	s.addMessage(t, "Spam", nil, date, "Subject: skipped\r\n\r\nhi")
+	r := s.retriever(t)
+
+	dir, err := ioutil.TempDir("", "maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, err := NewMaildirWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := SearchCriteria{Not: []SearchCriteria{{Subject: "skipped"}}}
+	if n, err := r.ExportMessages(Spam, filter, w); err != nil || n != 2 {
+		t.Fatalf("unexpected export: %v, %v", n, err)
+	}
+
+	if err := r.CreateMailbox("Archive"); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewMaildirReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.ImportMessages(MailBox("Archive"), rd); err != nil || n != 2 {
+		t.Fatalf("unexpected import: %v, %v", n, err)
+	}
+	box, err := s.user.GetMailbox("Archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := box.(*memory.Mailbox).Messages
+	if len(stored) != 2 {
+		t.Fatalf("unexpected number of imported messages: %v", len(stored))
+	}
+	if string(stored[0].Body) != "Subject: a\r\n\r\nhello" ||
+		!equalFlags(stored[0].Flags, []string{FlagSeen}) || !stored[0].Date.Equal(date) {
+		t.Errorf("unexpected imported message: %#v", stored[0])
+	}
+	if string(stored[1].Body) != testMultipartMessage || len(stored[1].Flags) != 0 {
+		t.Errorf("unexpected imported message: %#v", stored[1])
+	}
+
+	headerOnly := &sliceReader{Message{Subject: "header only"}}
+	if n, err := r.ImportMessages(MailBox("Archive"), headerOnly); err == nil || n != 0 {
+		t.Errorf("expected error for a message without raw bytes: %v, %v", n, err)
+	}
+}
+
+// sliceReader is a MessageReader of messages in memory
+type sliceReader []Message
+
+func (s *sliceReader) ReadMessage() (Message, error) {
+	if len(*s) == 0 {
+		return Message{}, io.EOF
+	}
+	msg := (*s)[0]
+	*s = (*s)[1:]
+	return msg, nil
+}
@@ -0,0 +1,154 @@
+package email
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+)
+
+// AddressCategory is the kind of mailbox an address belongs to
+type AddressCategory string
+
+// AddressCategory enum
+const (
+	// CategoryDisposable is a throwaway inbox such as mailinator.com
+	CategoryDisposable AddressCategory = "disposable"
+	// CategoryRole is a shared or system mailbox such as admin@ or noreply@
+	CategoryRole AddressCategory = "role"
+	// CategoryFree is a personal mailbox at a free provider in Domains
+	CategoryFree AddressCategory = "free"
+	// CategoryCorporate is any other domain, usually owned by a company
+	CategoryCorporate AddressCategory = "corporate"
+)
+
+// RoleLocalParts is the built-in list of role account names, compared
+// ignoring case, "+tag" and the separators ".", "-", "_"
+var RoleLocalParts = []string{
+	"abuse", "accounting", "accounts", "admin", "administrator", "all",
+	"billing", "careers", "contact", "customerservice", "devnull", "dns",
+	"donotreply", "enquiries", "feedback", "finance", "ftp", "hello", "help",
+	"helpdesk", "hostmaster", "hr", "info", "inquiries", "it", "jobs", "legal",
+	"list", "mail", "mailerdaemon", "marketing", "media", "newsletter",
+	"noc", "noreply", "notifications", "null", "office", "orders",
+	"postmaster", "press", "privacy", "root", "sales", "security", "service",
+	"spam", "staff", "support", "sysadmin", "team", "tech", "test",
+	"usenet", "uucp", "webmaster", "www",
+}
+
+// classifier holds the lists extended at runtime
+var classifier = struct {
+	mutex      *sync.RWMutex
+	disposable map[string]bool
+	roles      map[string]bool
+}{mutex: &sync.RWMutex{}}
+
+func init() {
+	classifier.disposable = make(map[string]bool)
+	for _, d := range DisposableDomains {
+		classifier.disposable[d] = true
+	}
+	classifier.roles = make(map[string]bool)
+	for _, r := range RoleLocalParts {
+		classifier.roles[normalizeRole(r)] = true
+	}
+}
+
+// AddDisposableDomains adds domains to the disposable list at runtime,
+// safe for concurrent use
+func AddDisposableDomains(domains ...string) {
+	classifier.mutex.Lock()
+	defer classifier.mutex.Unlock()
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d != "" {
+			classifier.disposable[d] = true
+		}
+	}
+}
+
+// LoadDisposableDomains adds domains from a list with one domain per line,
+// lines starting with "#" are ignored, the format of the
+// disposable-email-domains project blocklist
+func LoadDisposableDomains(r io.Reader) (int, error) {
+	domains := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	AddDisposableDomains(domains...)
+	return len(domains), nil
+}
+
+// AddRoleLocalParts adds role account names at runtime,
+// safe for concurrent use
+func AddRoleLocalParts(localParts ...string) {
+	classifier.mutex.Lock()
+	defer classifier.mutex.Unlock()
+	for _, r := range localParts {
+		if r = normalizeRole(r); r != "" {
+			classifier.roles[r] = true
+		}
+	}
+}
+
+// IsDisposable reports whether the address domain or one of its parent
+// domains is a disposable email domain
+func IsDisposable(address string) bool {
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	classifier.mutex.RLock()
+	defer classifier.mutex.RUnlock()
+	for {
+		if classifier.disposable[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// IsRoleAddress reports whether the local part is a role account name
+func IsRoleAddress(address string) bool {
+	at := strings.LastIndex(address, "@")
+	if at <= 0 {
+		return false
+	}
+	localPart := address[:at]
+	if plus := strings.Index(localPart, "+"); plus > 0 {
+		localPart = localPart[:plus]
+	}
+	classifier.mutex.RLock()
+	defer classifier.mutex.RUnlock()
+	return classifier.roles[normalizeRole(localPart)]
+}
+
+// ClassifyAddress returns the first matching category in order:
+// disposable, role, free, corporate
+func ClassifyAddress(address string) AddressCategory {
+	if IsDisposable(address) {
+		return CategoryDisposable
+	}
+	if IsRoleAddress(address) {
+		return CategoryRole
+	}
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	if _, found := ProviderForAddress(address); found || isKnownDomain(domain) {
+		return CategoryFree
+	}
+	return CategoryCorporate
+}
+
+func normalizeRole(localPart string) string {
+	return strings.NewReplacer(".", "", "-", "", "_", "").Replace(
+		strings.ToLower(strings.TrimSpace(localPart)))
+}
@@ -0,0 +1,53 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyAddress(t *testing.T) {
+	for address, expected := range map[string]AddressCategory{
+		"someone@mailinator.com":     CategoryDisposable,
+		"someone@inbox.yopmail.com":  CategoryDisposable,
+		"admin@gmail.com":            CategoryRole,
+		"No-Reply@example.com":       CategoryRole,
+		"postmaster+x@example.com":   CategoryRole,
+		"mailer_daemon@example.com":  CategoryRole,
+		"daominahpublic@gmail.com":   CategoryFree,
+		"someone@yahoo.co.jp":        CategoryFree,
+		"someone@zohomail.com":       CategoryFree,
+		"tung.dao@mycompany.example": CategoryCorporate,
+		"administrative@example.com": CategoryCorporate,
+	} {
+		if real := ClassifyAddress(address); real != expected {
+			t.Errorf("ClassifyAddress(%v): real %v, expected %v", address, real, expected)
+		}
+	}
+}
+
+func TestLoadDisposableDomains(t *testing.T) {
+	address := "someone@throwaway-test.example"
+	t.Cleanup(func() { // keep the global lists the same for -count > 1
+		classifier.mutex.Lock()
+		defer classifier.mutex.Unlock()
+		delete(classifier.disposable, "throwaway-test.example")
+		delete(classifier.disposable, "other-throwaway.example")
+		delete(classifier.roles, normalizeRole("Front.Desk"))
+	})
+	if IsDisposable(address) {
+		t.Fatal("unexpected disposable before loading")
+	}
+	n, err := LoadDisposableDomains(strings.NewReader(
+		"# comment\n\nthrowaway-test.example\n  Other-Throwaway.example \n"))
+	if err != nil || n != 2 {
+		t.Fatalf("unexpected LoadDisposableDomains result: %v, %v", n, err)
+	}
+	if !IsDisposable(address) || !IsDisposable("x@other-throwaway.example") {
+		t.Error("loaded domains are not disposable")
+	}
+
+	AddRoleLocalParts("Front.Desk")
+	if !IsRoleAddress("frontdesk@example.com") {
+		t.Error("added role is not detected")
+	}
+}
@@ -0,0 +1,50 @@
+// Command mailcapture is a SMTP server for development and QA that captures
+// all messages instead of delivering them, the captured messages can be
+// listed, viewed, searched and deleted in a web UI or a JSON API:
+//
+//	GET    /api/messages?q=search   list messages, newest first
+//	DELETE /api/messages            delete all messages
+//	GET    /api/messages/{id}       headers, text and HTML bodies, parts
+//	DELETE /api/messages/{id}       delete a message
+//	GET    /api/messages/{id}/raw   the message as received
+//	GET    /api/messages/{id}/parts/{index}  a decoded part or attachment
+//
+// Usage: mailcapture -smtp 127.0.0.1:1025 -http 127.0.0.1:8025 -dir ./mails
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+)
+
+func main() {
+	log.SetFlags(log.Lshortfile | log.Lmicroseconds)
+	smtpAddr := flag.String("smtp", "127.0.0.1:1025", "SMTP listen address")
+	httpAddr := flag.String("http", "127.0.0.1:8025", "web UI and JSON API listen address")
+	dir := flag.String("dir", "", "keep messages as .eml files (and their envelopes as .json) in this "+
+		"directory, default keeps messages in memory only")
+	flag.Parse()
+
+	store, err := newStore(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	listener, err := net.Listen("tcp", *smtpAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("SMTP listening on %v", listener.Addr())
+	go func() {
+		sink := &smtpSink{hostname: hostname, store: store}
+		log.Fatal(sink.serve(listener))
+	}()
+	log.Printf("HTTP listening on %v", *httpAddr)
+	log.Fatal(http.ListenAndServe(*httpAddr, (&webServer{store: store}).handler()))
+}
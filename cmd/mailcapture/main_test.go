@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mywrap/email"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: invoice\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+	"total 10$\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+	"<p>total <b>10$</b></p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=invoice.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\n" +
+	"JVBERi0=\r\n" +
+	"--outer--\r\n"
+
+// startSink returns the address of a SMTP sink that keeps messages in s
+func startSink(t *testing.T, s *store) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go (&smtpSink{hostname: "localhost", store: s}).serve(listener)
+	return listener.Addr().String()
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status of %v: %v", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	s, err := newStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smtpAddr := startSink(t, s)
+	web := httptest.NewServer((&webServer{store: s}).handler())
+	defer web.Close()
+
+	// NewSender sends a test email
+	sender, err := email.NewSender(smtpAddr, "app@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMail("qa@example.com", "welcome", email.TextHTML, "<h1>hi</h1>"); err != nil {
+		t.Fatal(err)
+	}
+	err = smtp.SendMail(smtpAddr, nil, "billing@example.com",
+		[]string{"bob@example.com", "audit@example.com"}, []byte(testMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summaries []messageSummary
+	getJSON(t, web.URL+"/api/messages", &summaries)
+	if len(summaries) != 3 || summaries[0].Subject != "invoice" ||
+		summaries[1].Subject != "welcome" || summaries[0].Attachments != 1 ||
+		len(summaries[0].RcptTo) != 2 || summaries[0].MailFrom != "billing@example.com" {
+		t.Fatalf("unexpected messages: %#v", summaries)
+	}
+	getJSON(t, web.URL+"/api/messages?q=10%24", &summaries)
+	if len(summaries) != 1 || summaries[0].FromName != "Alice" {
+		t.Fatalf("unexpected search result: %#v", summaries)
+	}
+
+	var msg messageDetail
+	getJSON(t, web.URL+"/api/messages/"+summaries[0].ID, &msg)
+	if msg.Text != "total 10$" || msg.HTML != "<p>total <b>10$</b></p>" ||
+		len(msg.Parts) != 3 || msg.Parts[2].Filename != "invoice.pdf" {
+		t.Fatalf("unexpected message: %#v", msg)
+	}
+	resp, err := http.Get(web.URL + msg.Parts[2].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(pdf) != "%PDF-" || resp.Header.Get("Content-Type") != "application/pdf" ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), "invoice.pdf") {
+		t.Errorf("unexpected attachment: %q, %v", pdf, resp.Header)
+	}
+	// the HTML alternative must not run script on the UI origin
+	for _, url := range []string{msg.Parts[1].URL, "/api/messages/" + msg.ID + "/raw"} {
+		resp, err = http.Get(web.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Header.Get("Content-Security-Policy") != "sandbox" ||
+			resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("unexpected headers of %v: %v", url, resp.Header)
+		}
+	}
+	if resp, err = http.Get(web.URL + msg.Parts[1].URL); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("unexpected HTML part disposition: %v", resp.Header)
+	}
+
+	resp, err = http.Get(web.URL + "/messages/" + msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "invoice.pdf") ||
+		!strings.Contains(string(page), "total 10$") {
+		t.Errorf("unexpected page: %s", page)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, web.URL+"/api/messages/"+msg.ID, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil ||
+		resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected delete: %v, %v", resp, err)
+	}
+	getJSON(t, web.URL+"/api/messages", &summaries)
+	if len(summaries) != 2 {
+		t.Errorf("unexpected messages after delete: %#v", summaries)
+	}
+}
+
+func TestStore_Dir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailcapture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := newStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.add("billing@example.com", []string{"bob@example.com"}, []byte(testMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the envelope has a Bcc recipient and a bounce address not in headers
+	if _, err := s.add("bounce@example.com", []string{"b@example.com", "bcc@example.com"},
+		[]byte("From: a@example.com\r\nTo: b@example.com\r\nSubject: second\r\n\r\nhi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.delete(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, c.ID+".*")); len(files) != 0 {
+		t.Errorf("unexpected files of a deleted message: %v", files)
+	}
+
+	reloaded, err := newStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := reloaded.list("")
+	if len(msgs) != 1 || msgs[0].Message.Subject != "second" || msgs[0].Text != "hi" {
+		t.Fatalf("unexpected reloaded messages: %#v", msgs)
+	}
+	if msgs[0].MailFrom != "bounce@example.com" ||
+		strings.Join(msgs[0].RcptTo, ",") != "b@example.com,bcc@example.com" {
+		t.Errorf("unexpected reloaded envelope: %v, %v", msgs[0].MailFrom, msgs[0].RcptTo)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxMessageBytes limits the DATA of a message, advertised as SIZE
+const maxMessageBytes = 32 << 20
+
+// smtpSink is a SMTP server that accepts any sender, recipient and
+// credentials and keeps the messages in a store instead of delivering them
+type smtpSink struct {
+	hostname string
+	store    *store
+}
+
+// serve accepts connections until the listener is closed
+func (s *smtpSink) serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// smtpSession is the state of a SMTP connection
+type smtpSession struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	mailFrom string
+	rcptTo   []string
+}
+
+func (s *smtpSession) reply(format string, args ...interface{}) {
+	fmt.Fprintf(s.conn, format+"\r\n", args...)
+}
+
+// readLine returns a line without the CRLF
+func (s *smtpSession) readLine() (string, error) {
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+	line, err := s.r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	session := &smtpSession{conn: conn, r: bufio.NewReader(conn)}
+	session.reply("220 %v ESMTP mailcapture", s.hostname)
+	for {
+		line, err := session.readLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			session.reply("250 %v", s.hostname)
+		case "EHLO":
+			session.reply("250-%v\r\n250-8BITMIME\r\n250-PIPELINING\r\n"+
+				"250-SIZE %v\r\n250 AUTH PLAIN LOGIN", s.hostname, maxMessageBytes)
+		case "AUTH":
+			if !session.auth(arg) {
+				return
+			}
+		case "MAIL":
+			if !strings.HasPrefix(strings.ToUpper(arg), "FROM:") {
+				session.reply("501 syntax: MAIL FROM:<address>")
+				continue
+			}
+			session.mailFrom, session.rcptTo = parsePath(arg[len("FROM:"):]), nil
+			session.reply("250 ok")
+		case "RCPT":
+			if !strings.HasPrefix(strings.ToUpper(arg), "TO:") {
+				session.reply("501 syntax: RCPT TO:<address>")
+				continue
+			}
+			session.rcptTo = append(session.rcptTo, parsePath(arg[len("TO:"):]))
+			session.reply("250 ok")
+		case "DATA":
+			if len(session.rcptTo) == 0 {
+				session.reply("503 need RCPT before DATA")
+				continue
+			}
+			session.reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := session.readData()
+			if err != nil {
+				session.reply("552 %v", err)
+				return
+			}
+			captured, err := s.store.add(session.mailFrom, session.rcptTo, data)
+			if err != nil {
+				log.Printf("error store message: %v", err)
+				session.reply("451 %v", err)
+				continue
+			}
+			log.Printf("captured %v from %v to %v: %v", captured.ID,
+				captured.MailFrom, captured.RcptTo, captured.Message.Subject)
+			session.reply("250 ok queued as %v", captured.ID)
+			session.mailFrom, session.rcptTo = "", nil
+		case "RSET":
+			session.mailFrom, session.rcptTo = "", nil
+			session.reply("250 ok")
+		case "NOOP":
+			session.reply("250 ok")
+		case "QUIT":
+			session.reply("221 bye")
+			return
+		default:
+			session.reply("502 command not implemented")
+		}
+	}
+}
+
+// auth accepts any credentials of PLAIN and LOGIN mechanisms,
+// returns false if the connection broke
+func (s *smtpSession) auth(arg string) bool {
+	words := strings.Fields(arg)
+	if len(words) == 0 {
+		s.reply("501 syntax: AUTH mechanism")
+		return true
+	}
+	switch strings.ToUpper(words[0]) {
+	case "PLAIN":
+		if len(words) == 1 {
+			s.reply("334 ")
+			if _, err := s.readLine(); err != nil {
+				return false
+			}
+		}
+	case "LOGIN":
+		challenges := []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"} // Username:, Password:
+		if len(words) > 1 {
+			challenges = challenges[1:]
+		}
+		for _, challenge := range challenges {
+			s.reply("334 %v", challenge)
+			if _, err := s.readLine(); err != nil {
+				return false
+			}
+		}
+	default:
+		s.reply("504 unrecognized authentication type")
+		return true
+	}
+	s.reply("235 authentication succeeded")
+	return true
+}
+
+// readData reads the message until the line ".", removes dot stuffing
+func (s *smtpSession) readData() ([]byte, error) {
+	data := &bytes.Buffer{}
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return data.Bytes(), nil
+		}
+		if data.Len()+len(line) > maxMessageBytes {
+			return nil, fmt.Errorf("message exceeds %v bytes", maxMessageBytes)
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// parsePath returns the address in "<address> parameters"
+func parsePath(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if i := strings.IndexByte(arg, '>'); strings.HasPrefix(arg, "<") && i > 0 {
+		return arg[1:i]
+	}
+	return strings.Fields(arg + " ")[0]
+}
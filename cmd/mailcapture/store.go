@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mywrap/email"
+)
+
+// captured is a message received by the SMTP sink
+type captured struct {
+	ID       string
+	Received time.Time
+	MailFrom string   // SMTP envelope sender
+	RcptTo   []string // SMTP envelope recipients, include Bcc
+	Message  email.Message
+	Text     string // plain text alternative
+	HTML     string // HTML alternative
+	Parts    []email.Part
+}
+
+// attachments returns the parts that are not a body alternative
+func (c *captured) attachments() []int {
+	ret := make([]int, 0)
+	for i, part := range c.Parts {
+		isBody := part.MIMEType == email.TextPlain || part.MIMEType == email.TextHTML
+		if part.Attachment || !isBody {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// matches reports whether the query is in the addresses, subject or bodies,
+// case insensitive
+func (c *captured) matches(query string) bool {
+	query = strings.ToLower(query)
+	for _, field := range []string{c.MailFrom, strings.Join(c.RcptTo, " "),
+		c.Message.From, c.Message.FromName, c.Message.Header.Get("To"),
+		c.Message.Header.Get("Cc"), c.Message.Subject, c.Text, c.HTML} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// store keeps captured messages in memory and, if dir is not empty, as
+// .eml files in dir so they are loaded again after a restart, the SMTP
+// envelope of each message is in a .json file with the same ID
+type store struct {
+	dir      string
+	mutex    sync.Mutex
+	messages map[string]*captured
+	count    int
+}
+
+// envelope is the content of a .json file, it is not in the .eml file
+// because the headers do not have Bcc recipients or the bounce address
+type envelope struct {
+	MailFrom string   `json:"mailFrom"`
+	RcptTo   []string `json:"rcptTo"`
+}
+
+// newStore loads the .eml files in dir if dir is not empty, a message
+// without a .json file gets an envelope from its From, To and Cc headers
+func newStore(dir string) (*store, error) {
+	s := &store{dir: dir, messages: make(map[string]*captured)}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create store dir: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		return nil, fmt.Errorf("list store dir: %v", err)
+	}
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read stored message: %v", err)
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("read stored message: %v", err)
+		}
+		c := newCaptured(strings.TrimSuffix(filepath.Base(file), ".eml"), raw)
+		c.Received = stat.ModTime()
+		data, err := ioutil.ReadFile(strings.TrimSuffix(file, ".eml") + ".json")
+		switch {
+		case err == nil:
+			var e envelope
+			if err := json.Unmarshal(data, &e); err != nil {
+				return nil, fmt.Errorf("read stored envelope %v: %v", c.ID, err)
+			}
+			c.MailFrom, c.RcptTo = e.MailFrom, e.RcptTo
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("read stored envelope: %v", err)
+		}
+		s.messages[c.ID] = c
+	}
+	return s, nil
+}
+
+// newCaptured parses a raw message, a malformed message is kept with
+// Message.ParseErr so it can still be inspected
+func newCaptured(id string, raw []byte) *captured {
+	msg, _ := email.ParseMessage(bytes.NewReader(raw))
+	c := &captured{ID: id, Received: time.Now(), Message: msg}
+	c.MailFrom = msg.From
+	for _, key := range []string{"To", "Cc"} {
+		if value := msg.Header.Get(key); value != "" {
+			c.RcptTo = append(c.RcptTo, value)
+		}
+	}
+	c.Parts, _ = msg.Parts()
+	for _, part := range c.Parts {
+		if part.Attachment {
+			continue
+		}
+		switch {
+		case part.MIMEType == email.TextPlain && c.Text == "":
+			c.Text = string(part.Content)
+		case part.MIMEType == email.TextHTML && c.HTML == "":
+			c.HTML = string(part.Content)
+		}
+	}
+	return c
+}
+
+// add stores a message received by the SMTP sink
+func (s *store) add(mailFrom string, rcptTo []string, raw []byte) (*captured, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	// IDs sort in receiving order
+	id := fmt.Sprintf("%v_%06d",
+		time.Now().UTC().Format("20060102T150405.000000000"), s.count)
+	c := newCaptured(id, raw)
+	c.MailFrom, c.RcptTo = mailFrom, rcptTo
+	if s.dir != "" {
+		// the envelope is written first so a loaded .eml file has it
+		data, err := json.Marshal(envelope{MailFrom: mailFrom, RcptTo: rcptTo})
+		if err != nil {
+			return nil, fmt.Errorf("write stored envelope: %v", err)
+		}
+		path := filepath.Join(s.dir, id+".json")
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("write stored envelope: %v", err)
+		}
+		path = filepath.Join(s.dir, id+".eml")
+		if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+			return nil, fmt.Errorf("write stored message: %v", err)
+		}
+	}
+	s.messages[id] = c
+	return c, nil
+}
+
+// list returns the messages that match the query, newest first,
+// an empty query matches all messages
+func (s *store) list(query string) []*captured {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := make([]*captured, 0, len(s.messages))
+	for _, c := range s.messages {
+		if query == "" || c.matches(query) {
+			ret = append(ret, c)
+		}
+	}
+	sort.Slice(ret, func(i int, j int) bool {
+		if !ret[i].Received.Equal(ret[j].Received) {
+			return ret[i].Received.After(ret[j].Received)
+		}
+		return ret[i].ID > ret[j].ID
+	})
+	return ret
+}
+
+// get returns nil if the message does not exist
+func (s *store) get(id string) *captured {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.messages[id]
+}
+
+// delete returns false if the message does not exist
+func (s *store) delete(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.messages[id] == nil {
+		return false, nil
+	}
+	delete(s.messages, id)
+	if s.dir != "" {
+		for _, ext := range []string{".eml", ".json"} {
+			err := os.Remove(filepath.Join(s.dir, id+ext))
+			if err != nil && !os.IsNotExist(err) {
+				return true, fmt.Errorf("delete stored message: %v", err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// deleteAll removes all messages
+func (s *store) deleteAll() error {
+	s.mutex.Lock()
+	ids := make([]string, 0, len(s.messages))
+	for id := range s.messages {
+		ids = append(ids, id)
+	}
+	s.mutex.Unlock()
+	for _, id := range ids {
+		if _, err := s.delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
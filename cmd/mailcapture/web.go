@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// messageSummary is an item of GET /api/messages
+type messageSummary struct {
+	ID          string    `json:"id"`
+	Received    time.Time `json:"received"`
+	MailFrom    string    `json:"mailFrom"`
+	RcptTo      []string  `json:"rcptTo"`
+	From        string    `json:"from"`
+	FromName    string    `json:"fromName"`
+	Subject     string    `json:"subject"`
+	Date        time.Time `json:"date"`
+	Size        uint32    `json:"size"`
+	Attachments int       `json:"attachments"`
+}
+
+// partInfo describes a part in GET /api/messages/{id},
+// the content is at URL
+type partInfo struct {
+	Index      int    `json:"index"`
+	MIMEType   string `json:"mimeType"`
+	Charset    string `json:"charset,omitempty"`
+	Attachment bool   `json:"attachment"`
+	Filename   string `json:"filename,omitempty"`
+	ContentID  string `json:"contentId,omitempty"`
+	Size       int    `json:"size"`
+	URL        string `json:"url"`
+}
+
+// messageDetail is the response of GET /api/messages/{id}
+type messageDetail struct {
+	messageSummary
+	Header     textproto.MIMEHeader `json:"header"`
+	Text       string               `json:"text"`
+	HTML       string               `json:"html"`
+	Parts      []partInfo           `json:"parts"`
+	ParseError string               `json:"parseError,omitempty"`
+}
+
+func summarize(c *captured) messageSummary {
+	return messageSummary{ID: c.ID, Received: c.Received, MailFrom: c.MailFrom,
+		RcptTo: c.RcptTo, From: c.Message.From, FromName: c.Message.FromName,
+		Subject: c.Message.Subject, Date: c.Message.Date, Size: c.Message.Size,
+		Attachments: len(c.attachments())}
+}
+
+func detail(c *captured) messageDetail {
+	ret := messageDetail{messageSummary: summarize(c), Header: c.Message.Header,
+		Text: c.Text, HTML: c.HTML, Parts: make([]partInfo, len(c.Parts))}
+	for i, part := range c.Parts {
+		ret.Parts[i] = partInfo{Index: i, MIMEType: string(part.MIMEType),
+			Charset: part.Charset, Attachment: part.Attachment,
+			Filename: part.Filename, ContentID: part.ContentID,
+			Size: len(part.Content), URL: partURL(c.ID, i)}
+	}
+	if c.Message.ParseErr != nil {
+		ret.ParseError = c.Message.ParseErr.Error()
+	}
+	return ret
+}
+
+func partURL(id string, index int) string {
+	return fmt.Sprintf("/api/messages/%v/parts/%v", id, index)
+}
+
+// webServer serves the JSON API under /api/ and the HTML UI
+type webServer struct {
+	store *store
+}
+
+func (s *webServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/messages", s.handleAPIMessages)
+	mux.HandleFunc("/api/messages/", s.handleAPIMessage)
+	mux.HandleFunc("/", s.handleUIList)
+	mux.HandleFunc("/messages/", s.handleUIMessage)
+	mux.HandleFunc("/delete", s.handleUIDeleteAll)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error write json: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err string) {
+	writeJSON(w, status, map[string]string{"error": err})
+}
+
+// handleAPIMessages lists messages (GET, optional search param q) or
+// deletes all messages (DELETE)
+func (s *webServer) handleAPIMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		msgs := s.store.list(r.URL.Query().Get("q"))
+		ret := make([]messageSummary, len(msgs))
+		for i, c := range msgs {
+			ret[i] = summarize(c)
+		}
+		writeJSON(w, http.StatusOK, ret)
+	case http.MethodDelete:
+		if err := s.store.deleteAll(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAPIMessage serves /api/messages/{id} (GET, DELETE),
+// /api/messages/{id}/raw and /api/messages/{id}/parts/{index}
+func (s *webServer) handleAPIMessage(w http.ResponseWriter, r *http.Request) {
+	words := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/messages/"), "/")
+	c := s.store.get(words[0])
+	if c == nil {
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	switch {
+	case len(words) == 1 && r.Method == http.MethodDelete:
+		if _, err := s.store.delete(c.ID); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method != http.MethodGet:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	case len(words) == 1:
+		writeJSON(w, http.StatusOK, detail(c))
+	case len(words) == 2 && words[1] == "raw":
+		setUntrustedHeaders(w)
+		w.Header().Set("Content-Type", "message/rfc822")
+		w.Write(c.Message.Raw())
+	case len(words) == 3 && words[1] == "parts":
+		index, err := strconv.Atoi(words[2])
+		if err != nil || index < 0 || index >= len(c.Parts) {
+			writeJSONError(w, http.StatusNotFound, "part not found")
+			return
+		}
+		part := c.Parts[index]
+		contentType := string(part.MIMEType)
+		if strings.HasPrefix(contentType, "text/") {
+			contentType += "; charset=utf-8" // Parts decodes text to UTF-8
+		}
+		setUntrustedHeaders(w)
+		w.Header().Set("Content-Type", contentType)
+		// also the body alternatives and inline parts, a HTML or SVG part
+		// opened from the UI would run its script on the UI origin
+		filename := part.Filename
+		if filename == "" {
+			filename = fmt.Sprintf("part%v", index)
+		}
+		w.Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Write(part.Content)
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// setUntrustedHeaders stops browsers from sniffing or running script in
+// captured content
+func setUntrustedHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+}
+
+var uiTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>mailcapture</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; }
+iframe { width: 100%; height: 30em; border: 1px solid #ddd; }
+pre { white-space: pre-wrap; background: #f6f6f6; padding: 8px; }
+</style></head><body>
+<h2><a href="/">mailcapture</a></h2>
+{{end}}
+
+{{define "list"}}{{template "header"}}
+<form method="get" action="/">
+<input name="q" value="{{.Query}}" placeholder="search">
+<button>Search</button>
+</form>
+<form method="post" action="/delete"><button>Delete all</button></form>
+<table>
+<tr><th>Received</th><th>From</th><th>To</th><th>Subject</th><th>Attachments</th></tr>
+{{range .Messages}}<tr>
+<td>{{time .Received}}</td><td>{{.From}}</td><td>{{join .RcptTo ", "}}</td>
+<td><a href="/messages/{{.ID}}">{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</a></td>
+<td>{{if .Attachments}}{{.Attachments}}{{end}}</td>
+</tr>{{else}}<tr><td colspan="5">no messages</td></tr>{{end}}
+</table></body></html>
+{{end}}
+
+{{define "message"}}{{template "header"}}
+<h3>{{.Subject}}</h3>
+<table>
+<tr><th>From</th><td>{{.FromName}} &lt;{{.From}}&gt;</td></tr>
+<tr><th>Envelope</th><td>{{.MailFrom}} to {{join .RcptTo ", "}}</td></tr>
+<tr><th>Date</th><td>{{time .Date}}</td></tr>
+<tr><th>Received</th><td>{{time .Received}}</td></tr>
+{{if .ParseError}}<tr><th>Parse error</th><td>{{.ParseError}}</td></tr>{{end}}
+</table>
+<p>
+<a href="/api/messages/{{.ID}}/raw">Raw</a> |
+<a href="/api/messages/{{.ID}}">JSON</a>
+</p>
+<form method="post" action="/messages/{{.ID}}/delete"><button>Delete</button></form>
+{{if .HTML}}<h4>HTML</h4>
+<iframe sandbox="" srcdoc="{{.HTML}}"></iframe>{{end}}
+{{if .Text}}<h4>Plain text</h4>
+<pre>{{.Text}}</pre>{{end}}
+{{if .Parts}}<h4>Parts</h4>
+<ul>{{range .Parts}}
+<li><a href="{{.URL}}">{{if .Filename}}{{.Filename}}{{else}}part {{.Index}}{{end}}</a>
+{{.MIMEType}}, {{.Size}} bytes{{if .Attachment}}, attachment{{end}}</li>{{end}}
+</ul>{{end}}
+<h4>Header</h4>
+<pre>{{range $key, $values := .Header}}{{range $values}}{{$key}}: {{.}}
+{{end}}{{end}}</pre>
+</body></html>
+{{end}}
+`))
+
+func renderUI(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := uiTemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("error render %v: %v", name, err)
+	}
+}
+
+// handleUIList shows the messages that match the search param q
+func (s *webServer) handleUIList(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query().Get("q")
+	msgs := s.store.list(query)
+	summaries := make([]messageSummary, len(msgs))
+	for i, c := range msgs {
+		summaries[i] = summarize(c)
+	}
+	renderUI(w, "list", map[string]interface{}{"Query": query, "Messages": summaries})
+}
+
+// handleUIMessage shows /messages/{id} and deletes on POST /messages/{id}/delete
+func (s *webServer) handleUIMessage(w http.ResponseWriter, r *http.Request) {
+	words := strings.Split(strings.TrimPrefix(r.URL.Path, "/messages/"), "/")
+	c := s.store.get(words[0])
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case len(words) == 1 && r.Method == http.MethodGet:
+		msg := detail(c)
+		// inline images refer to parts by Content-ID
+		for _, part := range msg.Parts {
+			if part.ContentID != "" {
+				msg.HTML = strings.Replace(msg.HTML, "cid:"+part.ContentID, part.URL, -1)
+			}
+		}
+		renderUI(w, "message", msg)
+	case len(words) == 2 && words[1] == "delete" && r.Method == http.MethodPost:
+		if _, err := s.store.delete(c.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleUIDeleteAll deletes all messages on POST /delete
+func (s *webServer) handleUIDeleteAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.store.deleteAll(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
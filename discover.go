@@ -0,0 +1,324 @@
+package email
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Resolver is the DNS part of *net.Resolver that discovery and
+// validation use, can be replaced in tests
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (
+		cname string, addrs []*net.SRV, err error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// DiscoveryMethod tells how a profile was found
+type DiscoveryMethod string
+
+// DiscoveryMethod enum
+const (
+	DiscoveredRegistry   DiscoveryMethod = "registry"   // Profiles
+	DiscoveredAutoconfig DiscoveryMethod = "autoconfig" // Mozilla autoconfig XML
+	DiscoveredSRV        DiscoveryMethod = "srv"        // RFC 6186 and RFC 8314 SRV records
+	DiscoveredMX         DiscoveryMethod = "mx"         // MX points to a provider in Profiles
+	DiscoveredGuess      DiscoveryMethod = "guess"      // imap.domain and smtp.domain, unverified
+)
+
+// Discoverer finds mail servers for an email address,
+// the zero value uses http.DefaultClient and net.DefaultResolver
+type Discoverer struct {
+	HTTPClient *http.Client
+	Resolver   Resolver
+}
+
+// DiscoverProfile is Discoverer{}.Discover
+func DiscoverProfile(ctx context.Context, address string) (
+	ProviderProfile, DiscoveryMethod, error) {
+	return Discoverer{}.Discover(ctx, address)
+}
+
+// Discover tries in order: the Profiles registry, Mozilla-style autoconfig,
+// SRV records, MX records, then returns a guess,
+// the profile SMTP.Addr() and IMAP.Addr() can be passed to NewSender
+// and NewRetriever, servers that they cannot connect to securely
+// (no TLS, or a TLS mode they do not use on that port) are skipped
+func (d Discoverer) Discover(ctx context.Context, address string) (
+	ProviderProfile, DiscoveryMethod, error) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || at == len(address)-1 {
+		return ProviderProfile{}, "", fmt.Errorf("invalid address %v", address)
+	}
+	domain := strings.ToLower(address[at+1:])
+	// the domain goes into autoconfig URLs and DNS queries
+	if strings.HasPrefix(domain, "[") || !isValidDomain(domain) {
+		return ProviderProfile{}, "", fmt.Errorf("invalid address domain %v", domain)
+	}
+	if profile, found := ProviderForAddress(address); found {
+		return profile, DiscoveredRegistry, nil
+	}
+
+	errs := make([]string, 0)
+	profile, err := d.discoverAutoconfig(ctx, address, domain)
+	if err == nil {
+		return profile, DiscoveredAutoconfig, nil
+	}
+	errs = append(errs, fmt.Sprintf("autoconfig: %v", err))
+	if ctx.Err() != nil {
+		return ProviderProfile{}, "", ctx.Err()
+	}
+	profile, err = d.discoverSRV(ctx, domain)
+	if err == nil {
+		return profile, DiscoveredSRV, nil
+	}
+	errs = append(errs, fmt.Sprintf("srv: %v", err))
+	profile, found, err := d.discoverMX(ctx, domain)
+	if err == nil && found {
+		return profile, DiscoveredMX, nil
+	}
+	if err == nil { // no MX or MX of an unknown provider
+		return ProviderProfile{
+			SMTP:    Endpoint{"smtp." + domain, 587, TLSStartTLS},
+			IMAP:    Endpoint{"imap." + domain, 993, TLSImplicit},
+			Domains: []string{domain},
+		}, DiscoveredGuess, nil
+	}
+	errs = append(errs, fmt.Sprintf("mx: %v", err))
+	return ProviderProfile{}, "", fmt.Errorf(
+		"discover %v: %v", domain, strings.Join(errs, "; "))
+}
+
+func (d Discoverer) httpClient() *http.Client {
+	if d.HTTPClient != nil {
+		return d.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (d Discoverer) resolver() Resolver {
+	if d.Resolver != nil {
+		return d.Resolver
+	}
+	return net.DefaultResolver
+}
+
+// autoconfigURLs are the locations Thunderbird checks, in order
+func autoconfigURLs(address string, domain string) []string {
+	query := url.Values{"emailaddress": {address}}.Encode()
+	return []string{
+		fmt.Sprintf("https://autoconfig.%v/mail/config-v1.1.xml?%v", domain, query),
+		fmt.Sprintf("https://%v/.well-known/autoconfig/mail/config-v1.1.xml?%v", domain, query),
+		fmt.Sprintf("https://autoconfig.thunderbird.net/v1.1/%v", domain),
+	}
+}
+
+// autoconfigServer is an incomingServer or outgoingServer element
+type autoconfigServer struct {
+	Type           string   `xml:"type,attr"`
+	Hostname       string   `xml:"hostname"`
+	Port           int      `xml:"port"`
+	SocketType     string   `xml:"socketType"`
+	Authentication []string `xml:"authentication"`
+}
+
+type autoconfigXML struct {
+	EmailProvider struct {
+		Domains  []string           `xml:"domain"`
+		Incoming []autoconfigServer `xml:"incomingServer"`
+		Outgoing []autoconfigServer `xml:"outgoingServer"`
+	} `xml:"emailProvider"`
+}
+
+func (d Discoverer) discoverAutoconfig(ctx context.Context,
+	address string, domain string) (ProviderProfile, error) {
+	var lastErr error
+	for _, configURL := range autoconfigURLs(address, domain) {
+		profile, err := d.fetchAutoconfig(ctx, configURL, address, domain)
+		if err == nil {
+			return profile, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return ProviderProfile{}, lastErr
+}
+
+func (d Discoverer) fetchAutoconfig(ctx context.Context,
+	configURL string, address string, domain string) (ProviderProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, configURL, nil)
+	if err != nil {
+		return ProviderProfile{}, err
+	}
+	resp, err := d.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return ProviderProfile{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ProviderProfile{}, fmt.Errorf("GET %v: %v", configURL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ProviderProfile{}, err
+	}
+	return parseAutoconfig(body, address, domain)
+}
+
+// parseAutoconfig converts a config-v1.1.xml to a profile, takes the first
+// IMAP and the first SMTP server usable by NewRetriever and NewSender
+func parseAutoconfig(body []byte, address string, domain string) (
+	ProviderProfile, error) {
+	var config autoconfigXML
+	if err := xml.Unmarshal(body, &config); err != nil {
+		return ProviderProfile{}, fmt.Errorf("xml Unmarshal: %v", err)
+	}
+	localPart := address[:strings.LastIndex(address, "@")]
+	placeholders := strings.NewReplacer("%EMAILADDRESS%", address,
+		"%EMAILLOCALPART%", localPart, "%EMAILDOMAIN%", domain)
+	toEndpoint := func(s autoconfigServer) Endpoint {
+		ret := Endpoint{Host: placeholders.Replace(s.Hostname), Port: s.Port}
+		switch strings.ToUpper(s.SocketType) {
+		case "SSL", "TLS":
+			ret.TLS = TLSImplicit
+		case "STARTTLS":
+			ret.TLS = TLSStartTLS
+		default:
+			ret.TLS = TLSNone
+		}
+		return ret
+	}
+	ret := ProviderProfile{Domains: config.EmailProvider.Domains}
+	mechanisms := make(map[string]bool)
+	for _, s := range config.EmailProvider.Incoming {
+		if endpoint := toEndpoint(s); s.Type == "imap" && ret.IMAP.Host == "" &&
+			endpoint.usableByRetriever() {
+			ret.IMAP = endpoint
+		}
+	}
+	for _, s := range config.EmailProvider.Outgoing {
+		if endpoint := toEndpoint(s); s.Type == "smtp" && ret.SMTP.Host == "" &&
+			endpoint.usableBySender() {
+			ret.SMTP = endpoint
+			for _, auth := range s.Authentication {
+				switch auth {
+				case "password-cleartext", "plain":
+					mechanisms["PLAIN"], mechanisms["LOGIN"] = true, true
+				case "password-encrypted", "secure":
+					mechanisms["CRAM-MD5"] = true
+				case "OAuth2":
+					mechanisms["XOAUTH2"] = true
+				}
+			}
+		}
+	}
+	if ret.IMAP.Host == "" || ret.SMTP.Host == "" {
+		return ProviderProfile{}, errors.New("config has no usable IMAP or SMTP server")
+	}
+	for _, mechanism := range []string{"PLAIN", "LOGIN", "CRAM-MD5", "XOAUTH2"} {
+		if mechanisms[mechanism] {
+			ret.AuthMechanisms = append(ret.AuthMechanisms, mechanism)
+		}
+	}
+	if len(ret.Domains) == 0 {
+		ret.Domains = []string{domain}
+	}
+	return ret, nil
+}
+
+// discoverSRV looks up RFC 8314 implicit TLS services first,
+// then RFC 6186 STARTTLS services
+func (d Discoverer) discoverSRV(ctx context.Context, domain string) (
+	ProviderProfile, error) {
+	lookup := func(services []string, tlsModes []TLSMode,
+		usable func(Endpoint) bool) (Endpoint, error) {
+		var lastErr error
+		for i, service := range services {
+			_, records, err := d.resolver().LookupSRV(ctx, service, "tcp", domain)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			for _, record := range records {
+				target := strings.TrimSuffix(record.Target, ".")
+				if target == "" { // "." means the service is not available
+					continue
+				}
+				endpoint := Endpoint{target, int(record.Port), tlsModes[i]}
+				if usable(endpoint) {
+					return endpoint, nil
+				}
+			}
+			lastErr = fmt.Errorf("no usable _%v._tcp record", service)
+		}
+		return Endpoint{}, lastErr
+	}
+	imapEndpoint, err := lookup([]string{"imaps", "imap"},
+		[]TLSMode{TLSImplicit, TLSStartTLS}, Endpoint.usableByRetriever)
+	if err != nil {
+		return ProviderProfile{}, err
+	}
+	smtpEndpoint, err := lookup([]string{"submissions", "submission"},
+		[]TLSMode{TLSImplicit, TLSStartTLS}, Endpoint.usableBySender)
+	if err != nil {
+		return ProviderProfile{}, err
+	}
+	return ProviderProfile{SMTP: smtpEndpoint, IMAP: imapEndpoint,
+		Domains: []string{domain}}, nil
+}
+
+// mxProviders maps MX host suffixes to providers that host custom domains
+var mxProviders = map[string]Provider{
+	"google.com":             GMail,
+	"googlemail.com":         GMail,
+	"protection.outlook.com": Office365,
+	"yahoodns.net":           Yahoo,
+	"zoho.com":               ZohoMail,
+	"zoho.eu":                ZohoMail,
+	"yandex.net":             Yandex,
+	"yandex.ru":              Yandex,
+	"messagingengine.com":    Fastmail,
+	"mail.ru":                MailRu,
+	"qq.com":                 QQMail,
+	"icloud.com":             ICloud,
+	"gmx.net":                GMXNet,
+}
+
+// discoverMX returns a registry profile if the domain's MX points to a
+// known provider, returns an error only if the lookup failed
+func (d Discoverer) discoverMX(ctx context.Context, domain string) (
+	ProviderProfile, bool, error) {
+	records, err := d.resolver().LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return ProviderProfile{}, false, nil
+		}
+		return ProviderProfile{}, false, err
+	}
+	for _, record := range records {
+		host := strings.ToLower(strings.TrimSuffix(record.Host, "."))
+		for suffix, provider := range mxProviders {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				profile := Profiles[provider]
+				profile.Domains = []string{domain}
+				profile.DomainPrefixes = nil
+				return profile, true, nil
+			}
+		}
+	}
+	return ProviderProfile{}, false, nil
+}
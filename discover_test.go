@@ -0,0 +1,178 @@
+package email
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// stubResolver answers DNS lookups from maps keyed by name
+type stubResolver struct {
+	srv map[string][]*net.SRV // key: "_service._proto.name"
+	mx  map[string][]*net.MX
+	a   map[string][]string
+}
+
+func (r stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (
+	string, []*net.SRV, error) {
+	key := "_" + service + "._" + proto + "." + name
+	records, found := r.srv[key]
+	if !found {
+		return "", nil, &net.DNSError{Err: "no such host", Name: key, IsNotFound: true}
+	}
+	return key, records, nil
+}
+
+func (r stubResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	records, found := r.mx[name]
+	if !found {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubHTTPClient serves the bodies keyed by URL host + path, 404 otherwise
+func stubHTTPClient(bodies map[string]string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, found := bodies[req.URL.Host+req.URL.Path]
+		resp := &http.Response{StatusCode: http.StatusOK, Status: "200 OK",
+			Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}
+		if !found {
+			resp.StatusCode, resp.Status = http.StatusNotFound, "404 Not Found"
+		}
+		return resp, nil
+	})}
+}
+
+const testAutoconfig = `<?xml version="1.0"?>
+<clientConfig version="1.1">
+  <emailProvider id="example.org">
+    <domain>example.org</domain>
+    <incomingServer type="pop3">
+      <hostname>pop.example.org</hostname><port>995</port><socketType>SSL</socketType>
+    </incomingServer>
+    <incomingServer type="imap">
+      <hostname>imap.%EMAILDOMAIN%</hostname><port>993</port><socketType>SSL</socketType>
+      <authentication>password-cleartext</authentication>
+    </incomingServer>
+    <outgoingServer type="smtp">
+      <hostname>smtp.example.org</hostname><port>587</port><socketType>STARTTLS</socketType>
+      <authentication>password-cleartext</authentication>
+      <authentication>OAuth2</authentication>
+    </outgoingServer>
+  </emailProvider>
+</clientConfig>`
+
+func TestDiscoverer(t *testing.T) {
+	d := Discoverer{
+		HTTPClient: stubHTTPClient(map[string]string{
+			"autoconfig.example.org/mail/config-v1.1.xml": testAutoconfig,
+		}),
+		Resolver: stubResolver{
+			srv: map[string][]*net.SRV{
+				"_imaps._tcp.srv.example":       {{Target: "mail.srv.example.", Port: 993}},
+				"_submissions._tcp.srv.example": {{Target: ".", Port: 0}},
+				"_submission._tcp.srv.example":  {{Target: "mail.srv.example.", Port: 587}},
+				"_imap._tcp.starttls.example":   {{Target: "mail.starttls.example.", Port: 143}},
+				"_submission._tcp.starttls.example": {
+					{Target: "mail.starttls.example.", Port: 587}},
+				// NewRetriever uses implicit TLS on ports other than 143
+				"_imap._tcp.odd.example": {{Target: "mail.odd.example.", Port: 1143}},
+				"_submission._tcp.odd.example": {
+					{Target: "mail.odd.example.", Port: 587}},
+			},
+			mx: map[string][]*net.MX{
+				"workspace.example": {{Host: "aspmx.l.google.com.", Pref: 1}},
+				"unknown.example":   {{Host: "mx.unknown.example.", Pref: 10}},
+			},
+		},
+	}
+	ctx := context.Background()
+	type testCase struct {
+		address string
+		method  DiscoveryMethod
+		smtp    Endpoint
+		imap    Endpoint
+	}
+	for _, c := range []testCase{
+		{"x@gmail.com", DiscoveredRegistry, Profiles[GMail].SMTP, Profiles[GMail].IMAP},
+		{"x@example.org", DiscoveredAutoconfig,
+			Endpoint{"smtp.example.org", 587, TLSStartTLS},
+			Endpoint{"imap.example.org", 993, TLSImplicit}},
+		{"x@srv.example", DiscoveredSRV,
+			Endpoint{"mail.srv.example", 587, TLSStartTLS},
+			Endpoint{"mail.srv.example", 993, TLSImplicit}},
+		{"x@starttls.example", DiscoveredSRV,
+			Endpoint{"mail.starttls.example", 587, TLSStartTLS},
+			Endpoint{"mail.starttls.example", 143, TLSStartTLS}},
+		{"x@odd.example", DiscoveredGuess,
+			Endpoint{"smtp.odd.example", 587, TLSStartTLS},
+			Endpoint{"imap.odd.example", 993, TLSImplicit}},
+		{"x@workspace.example", DiscoveredMX, Profiles[GMail].SMTP, Profiles[GMail].IMAP},
+		{"x@unknown.example", DiscoveredGuess,
+			Endpoint{"smtp.unknown.example", 587, TLSStartTLS},
+			Endpoint{"imap.unknown.example", 993, TLSImplicit}},
+	} {
+		profile, method, err := d.Discover(ctx, c.address)
+		if err != nil {
+			t.Errorf("Discover(%v): %v", c.address, err)
+			continue
+		}
+		if method != c.method || profile.SMTP != c.smtp || profile.IMAP != c.imap {
+			t.Errorf("Discover(%v): real %v %v %v, expected %v %v %v", c.address,
+				method, profile.SMTP, profile.IMAP, c.method, c.smtp, c.imap)
+		}
+	}
+	for _, address := range []string{"x@evil.example/path?", "x@[127.0.0.1]", "x@-a.com"} {
+		if _, _, err := d.Discover(ctx, address); err == nil {
+			t.Errorf("Discover(%v): expected error for an invalid domain", address)
+		}
+	}
+}
+
+func TestParseAutoconfig(t *testing.T) {
+	profile, err := parseAutoconfig([]byte(testAutoconfig), "x@example.org", "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(profile.AuthMechanisms, ",") != "PLAIN,LOGIN,XOAUTH2" {
+		t.Errorf("unexpected AuthMechanisms: %v", profile.AuthMechanisms)
+	}
+	if profile.IMAP != (Endpoint{"imap.example.org", 993, TLSImplicit}) {
+		t.Errorf("unexpected IMAP: %v", profile.IMAP)
+	}
+	// a clear text server is listed before the usable one
+	plainFirst := strings.Replace(testAutoconfig, `<incomingServer type="imap">`,
+		`<incomingServer type="imap"><hostname>plain.example.org</hostname>
+		<port>143</port><socketType>plain</socketType></incomingServer>
+		<incomingServer type="imap">`, 1)
+	profile, err = parseAutoconfig([]byte(plainFirst), "x@example.org", "example.org")
+	if err != nil || profile.IMAP.Host != "imap.example.org" {
+		t.Errorf("unexpected profile: %v, %v", profile.IMAP, err)
+	}
+	onlyPlain := strings.Replace(testAutoconfig, "<socketType>STARTTLS</socketType>",
+		"<socketType>plain</socketType>", 1)
+	if _, err := parseAutoconfig([]byte(onlyPlain), "x@example.org", "example.org"); err == nil {
+		t.Error("expected error for a config without a usable SMTP server")
+	}
+	if _, err := parseAutoconfig([]byte("<clientConfig/>"), "x@a.b", "a.b"); err == nil {
+		t.Error("expected error for empty config")
+	}
+}
+
+func (r stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, found := r.a[host]
+	if !found {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
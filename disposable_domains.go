@@ -0,0 +1,52 @@
+package email
+
+// DisposableDomains is a built-in list of throwaway email domains, used by
+// IsDisposable together with domains added by AddDisposableDomains or
+// LoadDisposableDomains, a bigger list is maintained at
+// https://github.com/disposable-email-domains/disposable-email-domains
+var DisposableDomains = []string{
+	// mailinator and its aliases
+	"mailinator.com", "mailinator.net", "mailinator2.com", "mailinator.org",
+	"notmailinator.com", "reallymymail.com", "sogetthis.com", "spamherelots.com",
+	"thisisnotmyrealemail.com", "binkmail.com", "bobmail.info", "suremail.info",
+	"tradermail.info", "veryrealemail.com", "zippymail.info", "safetymail.info",
+
+	// 10minutemail and similar timed inboxes
+	"10minutemail.com", "10minutemail.net", "10minutemail.co.uk", "10minmail.com",
+	"20minutemail.com", "30minutemail.com", "60minutemail.com", "minutemail.com",
+	"tempmail.com", "temp-mail.org", "temp-mail.io", "tempmail.net",
+	"tempmailo.com", "tempmail.plus", "tempr.email", "tempinbox.com",
+	"temporaryemail.net", "temporaryinbox.com", "tmpmail.org", "tmpmail.net",
+	"tmails.net", "emailondeck.com", "moakt.com", "mohmal.com",
+
+	// guerrillamail family
+	"guerrillamail.com", "guerrillamail.net", "guerrillamail.org",
+	"guerrillamail.biz", "guerrillamail.de", "guerrillamail.info",
+	"guerrillamailblock.com", "sharklasers.com", "grr.la", "pokemail.net",
+	"spam4.me",
+
+	// yopmail family
+	"yopmail.com", "yopmail.net", "yopmail.fr", "cool.fr.nf", "jetable.fr.nf",
+	"nospam.ze.tc", "nomail.xl.cx", "mega.zik.dj", "speed.1s.fr",
+	"courriel.fr.nf", "moncourrier.fr.nf", "monemail.fr.nf", "monmail.fr.nf",
+
+	// other well known services
+	"trashmail.com", "trashmail.net", "trashmail.de", "trashmail.io",
+	"trash-mail.com", "trashmail.me", "wegwerfmail.de", "wegwerfmail.net",
+	"spamgourmet.com", "spambox.us", "spamfree24.org", "mailnesia.com",
+	"maildrop.cc", "mailcatch.com", "mailnull.com", "mailpoof.com",
+	"mytemp.email", "mytrashmail.com", "dispostable.com", "discard.email",
+	"discardmail.com", "fakeinbox.com", "fakemail.net", "throwawaymail.com",
+	"throwam.com", "getnada.com", "nada.email", "getairmail.com",
+	"harakirimail.com", "inboxkitten.com", "mintemail.com", "mailforspam.com",
+	"burnermail.io", "33mail.com", "anonbox.net", "armyspy.com",
+	"cuvox.de", "dayrep.com", "einrot.com", "fleckens.hu", "gustr.com",
+	"jourrapide.com", "rhyta.com", "superrito.com", "teleworm.us",
+	"incognitomail.org", "mailexpire.com", "mailmoat.com", "meltmail.com",
+	"mt2015.com", "nwytg.net", "owlymail.com", "emltmp.com", "dropmail.me",
+	"1secmail.com", "1secmail.net", "1secmail.org", "byom.de", "dodgit.com",
+	"e4ward.com", "emailtemporanea.net", "eyepaste.com", "filzmail.com",
+	"instant-mail.de", "kasmail.com", "lroid.com", "mailde.de", "objectmail.com",
+	"proxymail.eu", "rcpt.at", "sofort-mail.de", "spamex.com", "tempemail.net",
+	"trbvm.com", "wh4f.org", "zetmail.com", "mvrht.net", "linshiyouxiang.net",
+}
@@ -1,70 +1,280 @@
 package email
 
-// Domains is a list of known email domains, may be used in validating
-var Domains = []string{
+import (
+	"strings"
+)
+
+// DomainInfo describes a known email domain
+type DomainInfo struct {
+	Domain string
+	// Region is an ISO 3166-1 alpha-2 country code such as "GB",
+	// or RegionGlobal for domains used worldwide
+	Region string
+	Owner  string // company that runs the mail service, example: "Microsoft"
+	// Provider is set if the domain resolves to a profile in Profiles
+	Provider Provider
+}
+
+// RegionGlobal is the DomainInfo.Region of domains used worldwide
+const RegionGlobal = "Global"
+
+// DomainInfos is a list of known email domains with their region and owner,
+// popular domains first
+var DomainInfos = []DomainInfo{
 	// global domains
-	"aol.com", "att.net", "comcast.net", "facebook.com", "gmail.com", "gmx.com",
-	"googlemail.com", "google.com", "hotmail.com", "hotmail.co.uk", "mac.com",
-	"me.com", "mail.com", "msn.com", "live.com", "sbcglobal.net", "verizon.net",
-	"yahoo.com", "yahoo.co.uk",
+	{Domain: "aol.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "att.net", Region: "US", Owner: "AT&T"},
+	{Domain: "comcast.net", Region: "US", Owner: "Comcast"},
+	{Domain: "facebook.com", Region: RegionGlobal, Owner: "Meta"},
+	{Domain: "gmail.com", Region: RegionGlobal, Owner: "Google"},
+	{Domain: "gmx.com", Region: RegionGlobal, Owner: "United Internet"},
+	{Domain: "googlemail.com", Region: RegionGlobal, Owner: "Google"},
+	{Domain: "google.com", Region: RegionGlobal, Owner: "Google"},
+	{Domain: "hotmail.com", Region: RegionGlobal, Owner: "Microsoft"},
+	{Domain: "hotmail.co.uk", Region: "GB", Owner: "Microsoft"},
+	{Domain: "mac.com", Region: RegionGlobal, Owner: "Apple"},
+	{Domain: "me.com", Region: RegionGlobal, Owner: "Apple"},
+	{Domain: "mail.com", Region: RegionGlobal, Owner: "United Internet"},
+	{Domain: "msn.com", Region: RegionGlobal, Owner: "Microsoft"},
+	{Domain: "live.com", Region: RegionGlobal, Owner: "Microsoft"},
+	{Domain: "sbcglobal.net", Region: "US", Owner: "AT&T"},
+	{Domain: "verizon.net", Region: "US", Owner: "Verizon"},
+	{Domain: "yahoo.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "yahoo.co.uk", Region: "GB", Owner: "Yahoo"},
 
 	// other global domains
-	"email.com", "fastmail.fm", "games.com", "gmx.net", "hush.com",
-	"hushmail.com", "icloud.com", "iname.com", "inbox.com", "lavabit.com",
-	"love.com", "outlook.com", "pobox.com", "protonmail.ch", "protonmail.com",
-	"tutanota.de", "tutanota.com", "tutamail.com", "tuta.io", "keemail.me",
-	"rocketmail.com", "safe-mail.net", "wow.com", "ygm.com", "ymail.com",
-	"zoho.com", "yandex.com",
+	{Domain: "email.com", Region: RegionGlobal, Owner: "United Internet"},
+	{Domain: "fastmail.fm", Region: RegionGlobal, Owner: "Fastmail"},
+	{Domain: "games.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "gmx.net", Region: "DE", Owner: "United Internet"},
+	{Domain: "hush.com", Region: RegionGlobal, Owner: "Hushmail"},
+	{Domain: "hushmail.com", Region: RegionGlobal, Owner: "Hushmail"},
+	{Domain: "icloud.com", Region: RegionGlobal, Owner: "Apple"},
+	{Domain: "iname.com", Region: RegionGlobal, Owner: "United Internet"},
+	{Domain: "inbox.com", Region: RegionGlobal, Owner: "Inbox.com"},
+	{Domain: "lavabit.com", Region: RegionGlobal, Owner: "Lavabit"},
+	{Domain: "love.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "outlook.com", Region: RegionGlobal, Owner: "Microsoft"},
+	{Domain: "pobox.com", Region: RegionGlobal, Owner: "Fastmail"},
+	{Domain: "protonmail.ch", Region: RegionGlobal, Owner: "Proton"},
+	{Domain: "protonmail.com", Region: RegionGlobal, Owner: "Proton"},
+	{Domain: "tutanota.de", Region: RegionGlobal, Owner: "Tutanota"},
+	{Domain: "tutanota.com", Region: RegionGlobal, Owner: "Tutanota"},
+	{Domain: "tutamail.com", Region: RegionGlobal, Owner: "Tutanota"},
+	{Domain: "tuta.io", Region: RegionGlobal, Owner: "Tutanota"},
+	{Domain: "keemail.me", Region: RegionGlobal, Owner: "Tutanota"},
+	{Domain: "rocketmail.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "safe-mail.net", Region: RegionGlobal, Owner: "Safe-mail"},
+	{Domain: "wow.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "ygm.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "ymail.com", Region: RegionGlobal, Owner: "Yahoo"},
+	{Domain: "zoho.com", Region: RegionGlobal, Owner: "Zoho"},
+	{Domain: "yandex.com", Region: RegionGlobal, Owner: "Yandex"},
 
 	// United States ISP domains
-	"bellsouth.net", "charter.net", "cox.net", "earthlink.net", "juno.com",
+	{Domain: "bellsouth.net", Region: "US", Owner: "AT&T"},
+	{Domain: "charter.net", Region: "US", Owner: "Charter"},
+	{Domain: "cox.net", Region: "US", Owner: "Cox"},
+	{Domain: "earthlink.net", Region: "US", Owner: "EarthLink"},
+	{Domain: "juno.com", Region: "US", Owner: "United Online"},
 
 	// British ISP domains
-	"btinternet.com", "virginmedia.com", "blueyonder.co.uk", "live.co.uk",
-	"ntlworld.com", "orange.net", "sky.com", "talktalk.co.uk", "tiscali.co.uk",
-	"virgin.net", "bt.com",
+	{Domain: "btinternet.com", Region: "GB", Owner: "BT"},
+	{Domain: "virginmedia.com", Region: "GB", Owner: "Virgin Media"},
+	{Domain: "blueyonder.co.uk", Region: "GB", Owner: "Virgin Media"},
+	{Domain: "live.co.uk", Region: "GB", Owner: "Microsoft"},
+	{Domain: "ntlworld.com", Region: "GB", Owner: "Virgin Media"},
+	{Domain: "orange.net", Region: "GB", Owner: "Orange"},
+	{Domain: "sky.com", Region: "GB", Owner: "Sky"},
+	{Domain: "talktalk.co.uk", Region: "GB", Owner: "TalkTalk"},
+	{Domain: "tiscali.co.uk", Region: "GB", Owner: "TalkTalk"},
+	{Domain: "virgin.net", Region: "GB", Owner: "Virgin Media"},
+	{Domain: "bt.com", Region: "GB", Owner: "BT"},
 
 	// Domains used in Asia
-	"sina.com", "sina.cn", "qq.com", "naver.com", "hanmail.net", "daum.net",
-	"nate.com", "yahoo.co.jp", "yahoo.co.kr", "yahoo.co.id", "yahoo.co.in",
-	"yahoo.com.sg", "yahoo.com.ph", "163.com", "yeah.net", "126.com",
-	"21cn.com", "aliyun.com", "foxmail.com",
+	{Domain: "sina.com", Region: "CN", Owner: "Sina"},
+	{Domain: "sina.cn", Region: "CN", Owner: "Sina"},
+	{Domain: "qq.com", Region: "CN", Owner: "Tencent"},
+	{Domain: "naver.com", Region: "KR", Owner: "Naver"},
+	{Domain: "hanmail.net", Region: "KR", Owner: "Kakao"},
+	{Domain: "daum.net", Region: "KR", Owner: "Kakao"},
+	{Domain: "nate.com", Region: "KR", Owner: "SK Communications"},
+	{Domain: "yahoo.co.jp", Region: "JP", Owner: "Yahoo Japan"},
+	{Domain: "yahoo.co.kr", Region: "KR", Owner: "Yahoo"},
+	{Domain: "yahoo.co.id", Region: "ID", Owner: "Yahoo"},
+	{Domain: "yahoo.co.in", Region: "IN", Owner: "Yahoo"},
+	{Domain: "yahoo.com.sg", Region: "SG", Owner: "Yahoo"},
+	{Domain: "yahoo.com.ph", Region: "PH", Owner: "Yahoo"},
+	{Domain: "163.com", Region: "CN", Owner: "NetEase"},
+	{Domain: "yeah.net", Region: "CN", Owner: "NetEase"},
+	{Domain: "126.com", Region: "CN", Owner: "NetEase"},
+	{Domain: "21cn.com", Region: "CN", Owner: "China Telecom"},
+	{Domain: "aliyun.com", Region: "CN", Owner: "Alibaba"},
+	{Domain: "foxmail.com", Region: "CN", Owner: "Tencent"},
 
 	// French ISP domains
-	"hotmail.fr", "live.fr", "laposte.net", "yahoo.fr", "wanadoo.fr",
-	"orange.fr", "gmx.fr", "sfr.fr", "neuf.fr", "free.fr",
+	{Domain: "hotmail.fr", Region: "FR", Owner: "Microsoft"},
+	{Domain: "live.fr", Region: "FR", Owner: "Microsoft"},
+	{Domain: "laposte.net", Region: "FR", Owner: "La Poste"},
+	{Domain: "yahoo.fr", Region: "FR", Owner: "Yahoo"},
+	{Domain: "wanadoo.fr", Region: "FR", Owner: "Orange"},
+	{Domain: "orange.fr", Region: "FR", Owner: "Orange"},
+	{Domain: "gmx.fr", Region: "FR", Owner: "United Internet"},
+	{Domain: "sfr.fr", Region: "FR", Owner: "SFR"},
+	{Domain: "neuf.fr", Region: "FR", Owner: "SFR"},
+	{Domain: "free.fr", Region: "FR", Owner: "Free"},
 
 	// German ISP domains
-	"gmx.de", "hotmail.de", "live.de", "online.de", "t-online.de", "web.de",
-	"yahoo.de",
+	{Domain: "gmx.de", Region: "DE", Owner: "United Internet"},
+	{Domain: "hotmail.de", Region: "DE", Owner: "Microsoft"},
+	{Domain: "live.de", Region: "DE", Owner: "Microsoft"},
+	{Domain: "mail.de", Region: "DE", Owner: "mail.de"},
+	{Domain: "online.de", Region: "DE", Owner: "United Internet"},
+	{Domain: "t-online.de", Region: "DE", Owner: "Deutsche Telekom"},
+	{Domain: "web.de", Region: "DE", Owner: "United Internet"},
+	{Domain: "yahoo.de", Region: "DE", Owner: "Yahoo"},
 
 	// Italian ISP domains
-	"libero.it", "virgilio.it", "hotmail.it", "aol.it", "tiscali.it",
-	"alice.it", "live.it", "yahoo.it", "email.it", "tin.it", "poste.it",
-	"teletu.it",
+	{Domain: "libero.it", Region: "IT", Owner: "Italiaonline"},
+	{Domain: "virgilio.it", Region: "IT", Owner: "Italiaonline"},
+	{Domain: "hotmail.it", Region: "IT", Owner: "Microsoft"},
+	{Domain: "aol.it", Region: "IT", Owner: "Yahoo"},
+	{Domain: "tiscali.it", Region: "IT", Owner: "Tiscali"},
+	{Domain: "alice.it", Region: "IT", Owner: "TIM"},
+	{Domain: "live.it", Region: "IT", Owner: "Microsoft"},
+	{Domain: "yahoo.it", Region: "IT", Owner: "Yahoo"},
+	{Domain: "email.it", Region: "IT", Owner: "Email.it"},
+	{Domain: "tin.it", Region: "IT", Owner: "TIM"},
+	{Domain: "poste.it", Region: "IT", Owner: "Poste Italiane"},
+	{Domain: "teletu.it", Region: "IT", Owner: "Vodafone"},
 
 	// Russian ISP domains
-	"bk.ru", "inbox.ru", "list.ru", "mail.ru", "rambler.ru", "yandex.by",
-	"yandex.com", "yandex.kz", "yandex.ru", "yandex.ua", "ya.ru",
+	{Domain: "bk.ru", Region: "RU", Owner: "VK"},
+	{Domain: "inbox.ru", Region: "RU", Owner: "VK"},
+	{Domain: "list.ru", Region: "RU", Owner: "VK"},
+	{Domain: "mail.ru", Region: "RU", Owner: "VK"},
+	{Domain: "rambler.ru", Region: "RU", Owner: "Rambler"},
+	{Domain: "yandex.by", Region: "BY", Owner: "Yandex"},
+	{Domain: "yandex.kz", Region: "KZ", Owner: "Yandex"},
+	{Domain: "yandex.ru", Region: "RU", Owner: "Yandex"},
+	{Domain: "yandex.ua", Region: "UA", Owner: "Yandex"},
+	{Domain: "ya.ru", Region: "RU", Owner: "Yandex"},
 
 	// Belgian ISP domains
-	"hotmail.be", "live.be", "skynet.be", "voo.be", "tvcablenet.be",
-	"telenet.be",
+	{Domain: "hotmail.be", Region: "BE", Owner: "Microsoft"},
+	{Domain: "live.be", Region: "BE", Owner: "Microsoft"},
+	{Domain: "skynet.be", Region: "BE", Owner: "Proximus"},
+	{Domain: "voo.be", Region: "BE", Owner: "VOO"},
+	{Domain: "tvcablenet.be", Region: "BE", Owner: "VOO"},
+	{Domain: "telenet.be", Region: "BE", Owner: "Telenet"},
+
+	// Dutch ISP domains
+	{Domain: "live.nl", Region: "NL", Owner: "Microsoft"},
 
 	// Argentinian ISP domains
-	"hotmail.com.ar", "live.com.ar", "yahoo.com.ar", "fibertel.com.ar",
-	"speedy.com.ar", "arnet.com.ar",
+	{Domain: "hotmail.com.ar", Region: "AR", Owner: "Microsoft"},
+	{Domain: "live.com.ar", Region: "AR", Owner: "Microsoft"},
+	{Domain: "yahoo.com.ar", Region: "AR", Owner: "Yahoo"},
+	{Domain: "fibertel.com.ar", Region: "AR", Owner: "Telecom Argentina"},
+	{Domain: "speedy.com.ar", Region: "AR", Owner: "Telefonica"},
+	{Domain: "arnet.com.ar", Region: "AR", Owner: "Telecom Argentina"},
 
 	// Domains used in Mexico
-	"yahoo.com.mx", "live.com.mx", "hotmail.es", "hotmail.com.mx",
-	"prodigy.net.mx",
+	{Domain: "yahoo.com.mx", Region: "MX", Owner: "Yahoo"},
+	{Domain: "live.com.mx", Region: "MX", Owner: "Microsoft"},
+	{Domain: "hotmail.es", Region: "ES", Owner: "Microsoft"},
+	{Domain: "hotmail.com.mx", Region: "MX", Owner: "Microsoft"},
+	{Domain: "prodigy.net.mx", Region: "MX", Owner: "Telmex"},
 
 	// Domains used in Canada
-	"yahoo.ca", "hotmail.ca", "bell.net", "shaw.ca", "sympatico.ca",
-	"rogers.com",
+	{Domain: "yahoo.ca", Region: "CA", Owner: "Yahoo"},
+	{Domain: "hotmail.ca", Region: "CA", Owner: "Microsoft"},
+	{Domain: "bell.net", Region: "CA", Owner: "Bell"},
+	{Domain: "shaw.ca", Region: "CA", Owner: "Rogers"},
+	{Domain: "sympatico.ca", Region: "CA", Owner: "Bell"},
+	{Domain: "rogers.com", Region: "CA", Owner: "Rogers"},
 
 	// Domains used in Brazil
-	"yahoo.com.br", "hotmail.com.br", "outlook.com.br", "uol.com.br",
-	"bol.com.br", "terra.com.br", "ig.com.br", "r7.com", "zipmail.com.br",
-	"globo.com", "globomail.com", "oi.com.br",
+	{Domain: "yahoo.com.br", Region: "BR", Owner: "Yahoo"},
+	{Domain: "hotmail.com.br", Region: "BR", Owner: "Microsoft"},
+	{Domain: "outlook.com.br", Region: "BR", Owner: "Microsoft"},
+	{Domain: "uol.com.br", Region: "BR", Owner: "UOL"},
+	{Domain: "bol.com.br", Region: "BR", Owner: "UOL"},
+	{Domain: "terra.com.br", Region: "BR", Owner: "Terra"},
+	{Domain: "ig.com.br", Region: "BR", Owner: "iG"},
+	{Domain: "r7.com", Region: "BR", Owner: "Record"},
+	{Domain: "zipmail.com.br", Region: "BR", Owner: "UOL"},
+	{Domain: "globo.com", Region: "BR", Owner: "Globo"},
+	{Domain: "globomail.com", Region: "BR", Owner: "Globo"},
+	{Domain: "oi.com.br", Region: "BR", Owner: "Oi"},
+}
+
+// Domains is a list of known email domains, may be used in validating,
+// DomainInfos has more details
+var Domains = domainNames(DomainInfos)
+
+func domainNames(infos []DomainInfo) []string {
+	ret := make([]string, 0, len(infos))
+	for _, info := range infos {
+		ret = append(ret, info.Domain)
+	}
+	return ret
+}
+
+func init() {
+	for i, info := range DomainInfos {
+		if profile, found := ProviderForAddress("@" + info.Domain); found {
+			DomainInfos[i].Provider = profile.Provider
+		}
+	}
+}
+
+// LookupDomain returns the DomainInfo of an address or a domain,
+// domains that are not in DomainInfos but are hosted by a provider in
+// Profiles (such as "zohomail.com") return a DomainInfo without Region
+func LookupDomain(addressOrDomain string) (DomainInfo, bool) {
+	domain := strings.ToLower(
+		addressOrDomain[strings.LastIndex(addressOrDomain, "@")+1:])
+	for _, info := range DomainInfos {
+		if info.Domain == domain {
+			return info, true
+		}
+	}
+	if profile, found := ProviderForAddress("@" + domain); found {
+		return DomainInfo{Domain: domain, Owner: ownerOfProvider(profile.Provider),
+			Provider: profile.Provider}, true
+	}
+	return DomainInfo{}, false
+}
+
+// ownerOfProvider returns the owner of the first domain of the provider
+func ownerOfProvider(provider Provider) string {
+	for _, info := range DomainInfos {
+		if info.Provider == provider {
+			return info.Owner
+		}
+	}
+	return ""
+}
+
+// DomainsByOwner returns known domains of the owner, example: "Microsoft"
+func DomainsByOwner(owner string) []DomainInfo {
+	ret := make([]DomainInfo, 0)
+	for _, info := range DomainInfos {
+		if strings.EqualFold(info.Owner, owner) {
+			ret = append(ret, info)
+		}
+	}
+	return ret
+}
+
+// DomainsByRegion returns known domains of the region, example: "BR"
+func DomainsByRegion(region string) []DomainInfo {
+	ret := make([]DomainInfo, 0)
+	for _, info := range DomainInfos {
+		if strings.EqualFold(info.Region, region) {
+			ret = append(ret, info)
+		}
+	}
+	return ret
 }
@@ -0,0 +1,47 @@
+package email
+
+import (
+	"testing"
+)
+
+func TestLookupDomain(t *testing.T) {
+	for input, expected := range map[string]DomainInfo{
+		"someone@Hotmail.fr": {Domain: "hotmail.fr", Region: "FR", Owner: "Microsoft", Provider: Outlook},
+		"yahoo.co.jp":        {Domain: "yahoo.co.jp", Region: "JP", Owner: "Yahoo Japan", Provider: YahooJapan},
+		"x@bk.ru":            {Domain: "bk.ru", Region: "RU", Owner: "VK", Provider: MailRu},
+		"x@uol.com.br":       {Domain: "uol.com.br", Region: "BR", Owner: "UOL"},
+		"x@zohomail.com":     {Domain: "zohomail.com", Owner: "Zoho", Provider: ZohoMail},
+	} {
+		real, found := LookupDomain(input)
+		if !found || real != expected {
+			t.Errorf("LookupDomain(%v): real %#v, expected %#v", input, real, expected)
+		}
+	}
+	if _, found := LookupDomain("x@example.com"); found {
+		t.Error("unexpected found example.com")
+	}
+}
+
+func TestDomainInfos(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, info := range DomainInfos {
+		if seen[info.Domain] {
+			t.Errorf("duplicate domain %v", info.Domain)
+		}
+		seen[info.Domain] = true
+		if info.Region == "" || info.Owner == "" {
+			t.Errorf("missing metadata: %#v", info)
+		}
+	}
+	if len(Domains) != len(DomainInfos) || Domains[0] != "aol.com" {
+		t.Errorf("unexpected Domains: %v", Domains)
+	}
+	for _, info := range DomainsByOwner("microsoft") {
+		if info.Provider != Outlook {
+			t.Errorf("unexpected provider of a Microsoft domain: %#v", info)
+		}
+	}
+	if n := len(DomainsByRegion("BR")); n != 12 {
+		t.Errorf("unexpected number of domains in BR: %v", n)
+	}
+}
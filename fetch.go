@@ -0,0 +1,202 @@
+package email
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/textproto"
+	"strings"
+
+	imap "github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message"
+	msgtextproto "github.com/emersion/go-message/textproto"
+)
+
+// FetchMode is how much of each message RetrieveMails downloads
+type FetchMode string
+
+// FetchMode enum
+const (
+	// FetchFull downloads the whole message including attachments
+	FetchFull FetchMode = "full"
+	// FetchEnvelope downloads only the envelope: Date, From, Subject, ..,
+	// Message Header and Body are empty
+	FetchEnvelope FetchMode = "envelope"
+	// FetchHeaders downloads the envelope and the header, Body is empty
+	FetchHeaders FetchMode = "headers"
+	// FetchText downloads the header and only the text part that would be
+	// the Body, found by the BODYSTRUCTURE, attachments are skipped
+	FetchText FetchMode = "text"
+)
+
+// FetchOption customizes RetrieveMails
+type FetchOption func(*fetchConfig)
+
+type fetchConfig struct {
+	mode     FetchMode
+	maxBytes uint32 // 0 means unlimited
+}
+
+func newFetchConfig(options []FetchOption) fetchConfig {
+	config := fetchConfig{mode: FetchFull}
+	for _, option := range options {
+		option(&config)
+	}
+	return config
+}
+
+// WithFetchMode sets how much of each message to download, default is FetchFull
+func WithFetchMode(mode FetchMode) FetchOption {
+	return func(c *fetchConfig) { c.mode = mode }
+}
+
+// WithMaxBytes limits the downloaded bytes of each message in FetchFull
+// mode or of the text part in FetchText mode, a longer message has
+// Truncated true and a partial Body, its parse errors are ignored
+func WithMaxBytes(maxBytes uint32) FetchOption {
+	return func(c *fetchConfig) { c.maxBytes = maxBytes }
+}
+
+// section returns the body section to fetch, nil if no body section is needed
+func (c fetchConfig) section() *imap.BodySectionName {
+	switch c.mode {
+	case FetchEnvelope:
+		return nil
+	case FetchHeaders, FetchText:
+		return &imap.BodySectionName{Peek: true,
+			BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}}
+	}
+	section := &imap.BodySectionName{Peek: true}
+	if c.maxBytes > 0 {
+		section.Partial = []int{0, int(c.maxBytes)}
+	}
+	return section
+}
+
+// parseHeader reads the header of a raw RFC 5322 message into msg.Header
+func parseHeader(raw io.Reader, msg *Message) error {
+	header, err := textproto.NewReader(bufio.NewReader(raw)).ReadMIMEHeader()
+	if len(header) > 0 {
+		msg.Header = header
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("read header: %v", err)
+	}
+	return nil
+}
+
+// textPart returns the path of the part that would be the Body, the first
+// text/html part or if none, the first text/plain part, attachments are skipped
+func textPart(bs *imap.BodyStructure) ([]int, *imap.BodyStructure) {
+	var retPath []int
+	var ret *imap.BodyStructure
+	bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if !strings.EqualFold(part.MIMEType, "text") ||
+			strings.EqualFold(part.Disposition, "attachment") {
+			return true
+		}
+		subType := strings.ToLower(part.MIMESubType)
+		isHTML := ret != nil && strings.EqualFold(ret.MIMESubType, "html")
+		if subType == "html" && !isHTML || subType == "plain" && ret == nil {
+			retPath, ret = path, part
+		}
+		return true
+	})
+	return retPath, ret
+}
+
+// fetchTextParts downloads the part that would be the Body of each message
+// that has a structure and decodes it into the message, the parts with the
+// same section (such as "1.1") are downloaded in 1 request,
+// a failure is set to the message ParseErr
+func (c fetchConfig) fetchTextParts(boxClient *client.Client, msgs []Message,
+	structures map[uint32]*imap.BodyStructure) {
+	type textRef struct {
+		msg  *Message
+		part *imap.BodyStructure
+	}
+	sections := make(map[string]*imap.BodySectionName)
+	groups := make(map[string][]textRef)
+	keys := make([]string, 0) // keep the request order stable
+	for i := range msgs {
+		bs := structures[msgs[i].UID]
+		if bs == nil {
+			continue
+		}
+		path, part := textPart(bs)
+		if part == nil {
+			continue
+		}
+		section := &imap.BodySectionName{Peek: true,
+			BodyPartName: imap.BodyPartName{Path: path}}
+		if c.maxBytes > 0 {
+			section.Partial = []int{0, int(c.maxBytes)}
+			msgs[i].Truncated = msgs[i].Truncated || part.Size > c.maxBytes
+		}
+		key := string(section.FetchItem())
+		if groups[key] == nil {
+			sections[key] = section
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], textRef{msg: &msgs[i], part: part})
+	}
+	for _, key := range keys {
+		section, refs := sections[key], groups[key]
+		uids := make([]uint32, len(refs))
+		for i, ref := range refs {
+			uids[i] = ref.msg.UID
+		}
+		imapMessages := make(chan *imap.Message, len(refs))
+		err := boxClient.UidFetch(uidSet(uids),
+			[]imap.FetchItem{imap.FetchUid, section.FetchItem()}, imapMessages)
+		if err != nil {
+			err = fmt.Errorf("imap fetch text part: %v", err)
+		}
+		bodies := make(map[uint32]imap.Literal)
+		for imapMsg := range imapMessages {
+			if body := imapMsg.GetBody(section); body != nil {
+				bodies[imapMsg.Uid] = body
+			}
+		}
+		for _, ref := range refs {
+			switch body := bodies[ref.msg.UID]; {
+			case err != nil:
+				ref.msg.ParseErr = err
+			case body == nil:
+				ref.msg.ParseErr = fmt.Errorf("imap body section not found")
+			default:
+				ref.msg.ParseErr = decodeTextPart(ref.part, body, ref.msg)
+			}
+		}
+	}
+}
+
+// decodeTextPart decodes the downloaded content of a text part into msg
+func decodeTextPart(part *imap.BodyStructure, content io.Reader, msg *Message) error {
+	params := make(map[string]string) // servers can send upper case keys
+	for key, value := range part.Params {
+		params[strings.ToLower(key)] = value
+	}
+	header := msgtextproto.Header{}
+	header.Set("Content-Type", mime.FormatMediaType(
+		strings.ToLower(part.MIMEType+"/"+part.MIMESubType), params))
+	header.Set("Content-Transfer-Encoding", part.Encoding)
+	entity, err := message.New(message.Header{Header: header}, content)
+	if err := ignoreUnknownCharset(err); err != nil {
+		return fmt.Errorf("decode text part: %v", err)
+	}
+	msg.MainPartMIMEType = TextPlain
+	if strings.EqualFold(part.MIMESubType, "html") {
+		msg.MainPartMIMEType = TextHTML
+	}
+	msg.Charset = strings.ToLower(params["charset"])
+	decoded, err := ioutil.ReadAll(entity.Body)
+	msg.Body = string(decoded)
+	if err != nil {
+		return fmt.Errorf("read text part: %v", err)
+	}
+	return nil
+}
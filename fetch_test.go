@@ -0,0 +1,105 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testMultipartMessage = "From: alice@example.com\r\n" +
+	"Subject: report\r\n" +
+	"X-Test: 1\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+	"plain text\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=ISO-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+	"<p>Caf=E9</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Disposition: attachment; filename=data.bin\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\n" +
+	"AAECAwQFBgcICQ==\r\n" +
+	"--outer--\r\n"
+
+func TestRetriever_FetchModes(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	s.addMessage(t, "INBOX", nil, time.Now(), testMultipartMessage)
+	r := s.retriever(t)
+	filter := SearchCriteria{Subject: "report"}
+	retrieve := func(options ...FetchOption) Message {
+		msgs, err := r.RetrieveMails(filter, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 || msgs[0].ParseErr != nil {
+			t.Fatalf("unexpected messages: %#v", msgs)
+		}
+		return msgs[0]
+	}
+
+	msg := retrieve(WithFetchMode(FetchEnvelope))
+	if msg.Subject != "report" || msg.Body != "" || msg.Header != nil ||
+		msg.Size != uint32(len(testMultipartMessage)) {
+		t.Errorf("unexpected envelope only message: %#v", msg)
+	}
+
+	msg = retrieve(WithFetchMode(FetchHeaders))
+	if msg.Header.Get("X-Test") != "1" || msg.Body != "" {
+		t.Errorf("unexpected headers only message: %#v", msg)
+	}
+
+	msg = retrieve(WithFetchMode(FetchText))
+	if msg.Body != "<p>Café</p>" || msg.MainPartMIMEType != TextHTML ||
+		msg.Charset != "iso-8859-1" || msg.Header.Get("X-Test") != "1" {
+		t.Errorf("unexpected text part message: %#v", msg)
+	}
+
+	msg = retrieve(WithFetchMode(FetchText), WithMaxBytes(5))
+	if msg.Body != "<p>Ca" || !msg.Truncated {
+		t.Errorf("unexpected truncated text part: %#v", msg)
+	}
+
+	msg = retrieve()
+	if msg.Body != "<p>Café</p>" || msg.Header.Get("Subject") != "report" || msg.Truncated {
+		t.Errorf("unexpected full message: %#v", msg)
+	}
+
+	msg = retrieve(WithMaxBytes(240))
+	if !msg.Truncated || !strings.Contains(msg.Body, "plain text") {
+		t.Errorf("unexpected truncated message: %#v", msg)
+	}
+}
+
+func TestRetriever_FetchTextBatch(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	for i := 0; i < 3; i++ {
+		s.addMessage(t, "INBOX", nil, time.Now(), testMultipartMessage)
+		s.addMessage(t, "INBOX", nil, time.Now(), "From: bob@example.com\r\n"+
+			"Subject: report\r\nContent-Type: text/plain\r\n\r\nsingle part\r\n")
+	}
+	r := s.retriever(t)
+	before := s.countCommands("UID FETCH")
+	msgs, err := r.RetrieveMails(SearchCriteria{Subject: "report"},
+		WithFetchMode(FetchText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 6 {
+		t.Fatalf("unexpected number of messages: %v", len(msgs))
+	}
+	for _, msg := range msgs {
+		if msg.ParseErr != nil || msg.Body != "<p>Café</p>" && msg.Body != "single part\r\n" {
+			t.Errorf("unexpected message: %v, %q", msg.ParseErr, msg.Body)
+		}
+	}
+	// the structures, then 1 request for each text part section: "1.2" and "1"
+	if n := s.countCommands("UID FETCH") - before; n != 3 {
+		t.Errorf("unexpected fetch requests: real %v, expected %v", n, 3)
+	}
+}
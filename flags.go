@@ -0,0 +1,100 @@
+package email
+
+import (
+	"fmt"
+	"strings"
+
+	imap "github.com/emersion/go-imap"
+)
+
+// System flags, other flags without the leading "\" are custom keywords
+// such as "$Forwarded", "$Junk" or "otp_used"
+const (
+	FlagSeen     = imap.SeenFlag
+	FlagAnswered = imap.AnsweredFlag
+	FlagFlagged  = imap.FlaggedFlag
+	FlagDeleted  = imap.DeletedFlag
+	FlagDraft    = imap.DraftFlag
+)
+
+// HasFlag reports whether the message had the flag when it was retrieved,
+// system flags are compared ignoring case
+func (m Message) HasFlag(flag string) bool {
+	for _, f := range m.Flags {
+		if f == flag || strings.HasPrefix(f, `\`) && strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFlags adds the flags to the messages in the box, example:
+// r.AddFlags(msg.MailBox, []uint32{msg.UID}, FlagFlagged, "otp_used")
+func (r Retriever) AddFlags(box MailBox, uids []uint32, flags ...string) error {
+	return r.storeFlags(box, uids, imap.AddFlags, flags)
+}
+
+// RemoveFlags removes the flags from the messages in the box
+func (r Retriever) RemoveFlags(box MailBox, uids []uint32, flags ...string) error {
+	return r.storeFlags(box, uids, imap.RemoveFlags, flags)
+}
+
+// SetFlags replaces all flags of the messages in the box
+func (r Retriever) SetFlags(box MailBox, uids []uint32, flags ...string) error {
+	return r.storeFlags(box, uids, imap.SetFlags, flags)
+}
+
+// MarkSeen marks the messages in the box as read
+func (r Retriever) MarkSeen(box MailBox, uids ...uint32) error {
+	return r.AddFlags(box, uids, FlagSeen)
+}
+
+// MarkUnseen marks the messages in the box as unread
+func (r Retriever) MarkUnseen(box MailBox, uids ...uint32) error {
+	return r.RemoveFlags(box, uids, FlagSeen)
+}
+
+func (r Retriever) storeFlags(box MailBox, uids []uint32, op imap.FlagsOp,
+	flags []string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(flags))
+	for i, flag := range flags {
+		if !isValidFlag(flag) {
+			return fmt.Errorf("invalid flag %q", flag)
+		}
+		values[i] = flag
+	}
+	boxClient, unlock, err := r.selectedClient(box)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := r.selectWritable(boxClient, box); err != nil {
+		return err
+	}
+	err = boxClient.UidStore(uidSet(uids), imap.FormatFlagsOp(op, true), values, nil)
+	if err != nil {
+		return fmt.Errorf("store flags %v: %v", flags, err)
+	}
+	return nil
+}
+
+// isValidFlag accepts a system flag or a keyword, a keyword is an IMAP atom:
+// printable ASCII without space and the specials `(){%*"\]`
+func isValidFlag(flag string) bool {
+	keyword := flag
+	if strings.HasPrefix(flag, `\`) {
+		keyword = flag[1:]
+	}
+	if keyword == "" {
+		return false
+	}
+	for _, c := range []byte(keyword) {
+		if c <= 0x20 || c >= 0x7f || strings.IndexByte(`(){%*"\]`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package email
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetriever_Flags(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	s.addMessage(t, "INBOX", nil, time.Now(),
+		"From: otp@example.com\r\nSubject: code\r\n\r\n123456")
+	r := s.retriever(t)
+
+	unseen, err := r.RetrieveMails(SearchCriteria{WithoutFlags: []string{FlagSeen}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reading examines the boxes, only flag operations select read-write
+	if n := s.countCommands("SELECT"); n != 0 {
+		t.Errorf("unexpected read-write selects before changing flags: %v", n)
+	}
+	if len(unseen) != 1 || unseen[0].UID != 7 || unseen[0].HasFlag(FlagSeen) {
+		t.Fatalf("unexpected unseen messages: %#v", unseen)
+	}
+	msg := unseen[0]
+	if err := r.MarkSeen(msg.MailBox, msg.UID); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.countCommands("SELECT"); n != 1 {
+		t.Errorf("unexpected read-write selects: real %v, expected %v", n, 1)
+	}
+	if err := r.AddFlags(msg.MailBox, []uint32{msg.UID}, FlagFlagged, "otp_used"); err != nil {
+		t.Fatal(err)
+	}
+	unseen, err = r.RetrieveMails(SearchCriteria{WithoutFlags: []string{FlagSeen}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unseen) != 0 {
+		t.Errorf("unexpected unseen messages after MarkSeen: %#v", unseen)
+	}
+
+	flagged, err := r.RetrieveMails(SearchCriteria{WithFlags: []string{"otp_used"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flagged) != 1 || !flagged[0].HasFlag(`\flagged`) ||
+		!flagged[0].HasFlag(FlagSeen) || flagged[0].Body != "123456" {
+		t.Fatalf("unexpected flagged messages: %#v", flagged)
+	}
+
+	if err := r.MarkUnseen(Inbox, msg.UID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RemoveFlags(Inbox, []uint32{msg.UID}, "otp_used"); err != nil {
+		t.Fatal(err)
+	}
+	all, err := r.RetrieveMails(SearchCriteria{From: "otp@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || len(all[0].Flags) != 1 || !all[0].HasFlag(FlagFlagged) {
+		t.Errorf("unexpected flags: %#v", all)
+	}
+
+	if err := r.AddFlags(Inbox, []uint32{msg.UID}, "bad keyword"); err == nil {
+		t.Errorf("expected error for an invalid keyword")
+	}
+}
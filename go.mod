@@ -5,6 +5,7 @@ go 1.14
 require (
 	github.com/emersion/go-imap v1.1.0
 	github.com/emersion/go-message v0.14.1
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 )
@@ -0,0 +1,261 @@
+package email
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	imap "github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+)
+
+// fakeIMAPServer is an in memory IMAP server over TLS for offline tests,
+// it has mailboxes "INBOX" (1 message with UID 6) and "Spam"
+type fakeIMAPServer struct {
+	addr string
+	user backend.User
+	log  *syncBuffer // the traffic of all connections
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func newFakeIMAPServer(t *testing.T) *fakeIMAPServer {
+	be := memory.New()
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := user.CreateMailbox("Spam"); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCertificate(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &syncBuffer{}
+	s := server.New(lockedBackend{Backend: be, mutex: &sync.Mutex{}})
+	s.AllowInsecureAuth = true
+	s.Debug = log
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+	return &fakeIMAPServer{addr: listener.Addr().String(), user: user, log: log}
+}
+
+// lockedBackend serializes the calls to a backend, the memory backend
+// is not safe for concurrent use by many connections
+type lockedBackend struct {
+	backend.Backend
+	mutex *sync.Mutex
+}
+
+func (b lockedBackend) Login(connInfo *imap.ConnInfo, username string,
+	password string) (backend.User, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	user, err := b.Backend.Login(connInfo, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return lockedUser{User: user, mutex: b.mutex}, nil
+}
+
+type lockedUser struct {
+	backend.User
+	mutex *sync.Mutex
+}
+
+func (u lockedUser) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	boxes, err := u.User.ListMailboxes(subscribed)
+	for i, box := range boxes {
+		boxes[i] = lockedMailbox{Mailbox: box, mutex: u.mutex}
+	}
+	return boxes, err
+}
+
+func (u lockedUser) GetMailbox(name string) (backend.Mailbox, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	box, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return lockedMailbox{Mailbox: box, mutex: u.mutex}, nil
+}
+
+func (u lockedUser) CreateMailbox(name string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.User.CreateMailbox(name)
+}
+
+func (u lockedUser) DeleteMailbox(name string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.User.DeleteMailbox(name)
+}
+
+func (u lockedUser) RenameMailbox(existingName string, newName string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.User.RenameMailbox(existingName, newName)
+}
+
+type lockedMailbox struct {
+	backend.Mailbox
+	mutex *sync.Mutex
+}
+
+func (m lockedMailbox) Info() (*imap.MailboxInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.Info()
+}
+
+func (m lockedMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.Status(items)
+}
+
+func (m lockedMailbox) SetSubscribed(subscribed bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.SetSubscribed(subscribed)
+}
+
+// ListMessages sends to ch while holding the lock, the server reads ch
+// without calling the backend
+func (m lockedMailbox) ListMessages(uid bool, seqSet *imap.SeqSet,
+	items []imap.FetchItem, ch chan<- *imap.Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.ListMessages(uid, seqSet, items, ch)
+}
+
+func (m lockedMailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) (
+	[]uint32, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.SearchMessages(uid, criteria)
+}
+
+func (m lockedMailbox) CreateMessage(flags []string, date time.Time,
+	body imap.Literal) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.CreateMessage(flags, date, body)
+}
+
+func (m lockedMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet,
+	op imap.FlagsOp, flags []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.UpdateMessagesFlags(uid, seqSet, op, flags)
+}
+
+func (m lockedMailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, dest string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.CopyMessages(uid, seqSet, dest)
+}
+
+func (m lockedMailbox) Expunge() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Mailbox.Expunge()
+}
+
+// countCommands returns how many times clients sent the command,
+// example: "UID FETCH"
+func (s *fakeIMAPServer) countCommands(command string) int {
+	pattern := regexp.MustCompile(`(?m)^\S+ ` + regexp.QuoteMeta(command) + ` `)
+	return len(pattern.FindAllString(s.log.String(), -1))
+}
+
+// retriever returns a Retriever connected to the server
+func (s *fakeIMAPServer) retriever(t *testing.T, options ...RetrieverOption) *Retriever {
+	options = append([]RetrieverOption{WithRetrieverTLSConfig(
+		&tls.Config{InsecureSkipVerify: true})}, options...)
+	r, err := NewRetriever(s.addr, "username", "password", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.CloseConnections)
+	return r
+}
+
+// addMessage appends a raw RFC 5322 message to a mailbox on the server
+// with an IMAP APPEND
+func (s *fakeIMAPServer) addMessage(t *testing.T, mailbox string,
+	flags []string, date time.Time, raw string) {
+	if err := s.appendMessage(mailbox, flags, date, raw); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// appendMessage is addMessage for goroutines other than the test one,
+// which must not call t.Fatal
+func (s *fakeIMAPServer) appendMessage(mailbox string,
+	flags []string, date time.Time, raw string) error {
+	cli, err := client.DialTLS(s.addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	defer cli.Logout()
+	if err := cli.Login("username", "password"); err != nil {
+		return err
+	}
+	return cli.Append(mailbox, flags, date, bytes.NewBufferString(raw))
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
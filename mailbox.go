@@ -0,0 +1,193 @@
+package email
+
+import (
+	"fmt"
+	"sync"
+
+	imap "github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// MailboxInfo describes a mailbox (folder) on the IMAP server
+type MailboxInfo struct {
+	Name      string
+	Delimiter string // hierarchy separator, such as "/" or "."
+	// Attributes such as \HasChildren, \Noselect and SPECIAL-USE
+	// attributes such as \Sent, \Junk, \Trash
+	Attributes []string
+
+	// following fields are from STATUS, zero for \Noselect mailboxes
+
+	Messages    uint32
+	Unseen      uint32
+	UIDNext     uint32
+	UIDValidity uint32
+}
+
+// HasAttribute reports whether the mailbox has the attribute,
+// example: info.HasAttribute(imap.SentAttr)
+func (m MailboxInfo) HasAttribute(attr string) bool {
+	for _, a := range m.Attributes {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// adminClient returns a connection for commands that do not depend on the
+// selected mailbox such as LIST, CREATE, STATUS, the connection is locked
+// until the caller calls unlock
+func (r Retriever) adminClient() (*client.Client, func(), error) {
+	r.mutex.Lock()
+	var cli *client.Client
+	var lock *sync.Mutex
+	for _, box := range []MailBox{Inbox, Spam} {
+		if cli = r.boxClients[box]; cli != nil {
+			lock = r.boxLocks[box]
+			break
+		}
+	}
+	r.mutex.Unlock()
+	if cli == nil {
+		return nil, nil, fmt.Errorf("retriever has no connection")
+	}
+	lock.Lock()
+	return cli, lock.Unlock, nil
+}
+
+// listMailboxInfos returns the LIST response for all mailboxes
+func (r Retriever) listMailboxInfos() ([]*imap.MailboxInfo, error) {
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	infos := make(chan *imap.MailboxInfo, 100)
+	errChan := make(chan error, 1)
+	go func() { errChan <- cli.List("", "*", infos) }()
+	ret := make([]*imap.MailboxInfo, 0)
+	for info := range infos {
+		ret = append(ret, info)
+	}
+	if err := <-errChan; err != nil {
+		return nil, fmt.Errorf("list mailboxes: %v", err)
+	}
+	return ret, nil
+}
+
+// ListMailboxes returns all mailboxes with their STATUS counts
+func (r Retriever) ListMailboxes() ([]MailboxInfo, error) {
+	infos, err := r.listMailboxInfos()
+	if err != nil {
+		return nil, err
+	}
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	statusItems := []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen,
+		imap.StatusUidNext, imap.StatusUidValidity}
+	ret := make([]MailboxInfo, 0, len(infos))
+	for _, info := range infos {
+		mailbox := MailboxInfo{Name: info.Name, Delimiter: info.Delimiter,
+			Attributes: info.Attributes}
+		if !mailbox.HasAttribute(imap.NoSelectAttr) {
+			status, err := cli.Status(info.Name, statusItems)
+			if err != nil {
+				return nil, fmt.Errorf("status %v: %v", info.Name, err)
+			}
+			mailbox.Messages, mailbox.Unseen = status.Messages, status.Unseen
+			mailbox.UIDNext, mailbox.UIDValidity = status.UidNext, status.UidValidity
+		}
+		ret = append(ret, mailbox)
+	}
+	return ret, nil
+}
+
+// checkNotInUse returns an error if the Retriever selected the mailbox
+func (r Retriever) checkNotInUse(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for box, boxName := range r.boxNames {
+		if boxName == name {
+			return fmt.Errorf("mailbox %v is used by the retriever as %v", name, box)
+		}
+	}
+	return nil
+}
+
+// CreateMailbox creates a mailbox, use the server delimiter (see
+// MailboxInfo.Delimiter) in the name to create a child mailbox
+func (r Retriever) CreateMailbox(name string) error {
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := cli.Create(name); err != nil {
+		return fmt.Errorf("create mailbox %v: %v", name, err)
+	}
+	return nil
+}
+
+// RenameMailbox renames a mailbox, the Inbox and Spam mailboxes the
+// Retriever uses cannot be renamed
+func (r Retriever) RenameMailbox(existingName string, newName string) error {
+	if err := r.checkNotInUse(existingName); err != nil {
+		return err
+	}
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := cli.Rename(existingName, newName); err != nil {
+		return fmt.Errorf("rename mailbox %v: %v", existingName, err)
+	}
+	return nil
+}
+
+// DeleteMailbox deletes a mailbox and its messages, the Inbox and Spam
+// mailboxes the Retriever uses cannot be deleted
+func (r Retriever) DeleteMailbox(name string) error {
+	if err := r.checkNotInUse(name); err != nil {
+		return err
+	}
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := cli.Delete(name); err != nil {
+		return fmt.Errorf("delete mailbox %v: %v", name, err)
+	}
+	return nil
+}
+
+// Subscribe adds the mailbox to the subscribed list that mail clients show
+func (r Retriever) Subscribe(name string) error {
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := cli.Subscribe(name); err != nil {
+		return fmt.Errorf("subscribe mailbox %v: %v", name, err)
+	}
+	return nil
+}
+
+// Unsubscribe removes the mailbox from the subscribed list
+func (r Retriever) Unsubscribe(name string) error {
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := cli.Unsubscribe(name); err != nil {
+		return fmt.Errorf("unsubscribe mailbox %v: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package email
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetriever_ListMailboxes(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	s.addMessage(t, "Spam", nil, time.Now(), "Subject: win\r\n\r\nprize")
+	s.addMessage(t, "Spam", nil, time.Now(), "Subject: win2\r\n\r\nprize")
+	r := s.retriever(t)
+
+	boxes, err := r.ListMailboxes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]MailboxInfo)
+	for _, box := range boxes {
+		byName[box.Name] = box
+	}
+	if len(byName) != 2 {
+		t.Fatalf("unexpected mailboxes: %#v", boxes)
+	}
+	inbox := byName["INBOX"]
+	if inbox.Messages != 1 || inbox.UIDNext != 7 || inbox.Delimiter != "/" {
+		t.Errorf("unexpected inbox: %#v", inbox)
+	}
+	if spam := byName["Spam"]; spam.Messages != 2 || spam.UIDNext != 3 {
+		t.Errorf("unexpected spam: %#v", spam)
+	}
+}
+
+func TestRetriever_ManageMailboxes(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	r := s.retriever(t)
+
+	if err := r.CreateMailbox("Receipts"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Subscribe("Receipts"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RenameMailbox("Receipts", "Invoices"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateMailbox("Invoices"); err == nil {
+		t.Errorf("expected error when creating an existing mailbox")
+	}
+	if err := r.RenameMailbox("Spam", "Junk"); err == nil {
+		t.Errorf("expected error when renaming a mailbox in use")
+	}
+	if err := r.DeleteMailbox("INBOX"); err == nil {
+		t.Errorf("expected error when deleting a mailbox in use")
+	}
+	if err := r.DeleteMailbox("Invoices"); err != nil {
+		t.Fatal(err)
+	}
+	boxes, err := r.ListMailboxes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boxes) != 2 {
+		t.Errorf("unexpected mailboxes after delete: %#v", boxes)
+	}
+}
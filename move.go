@@ -0,0 +1,204 @@
+package email
+
+import (
+	"fmt"
+
+	imap "github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// mailboxName returns the real mail box name on server of Inbox and Spam,
+// other MailBox values are used as is, example: MailBox("Archive")
+func (r Retriever) mailboxName(box MailBox) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if name, found := r.boxNames[box]; found {
+		return name
+	}
+	return string(box)
+}
+
+// CopyMessages copies the messages from a retrieved box (Inbox or Spam) to
+// another box, such as Inbox, Spam or MailBox("Archive")
+func (r Retriever) CopyMessages(from MailBox, uids []uint32, to MailBox) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	boxClient, unlock, err := r.selectedClient(from)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return r.copyMessages(boxClient, uids, to)
+}
+
+// copyMessages needs the lock of the box connection
+func (r Retriever) copyMessages(boxClient *client.Client, uids []uint32, to MailBox) error {
+	if err := boxClient.UidCopy(uidSet(uids), r.mailboxName(to)); err != nil {
+		return fmt.Errorf("copy messages to %v: %v", to, err)
+	}
+	return nil
+}
+
+// MoveMessages moves the messages from a retrieved box (Inbox or Spam) to
+// another box, it uses the MOVE extension (RFC 6851) if the server supports
+// it, otherwise COPY then delete the messages from the source box like
+// DeleteMessages: if the server supports neither MOVE nor UIDPLUS, the
+// EXPUNGE also removes all other messages flagged as \Deleted in the
+// source box, check Retriever.SupportsSafeMove before moving from a box
+// where other clients flag messages as \Deleted
+func (r Retriever) MoveMessages(from MailBox, uids []uint32, to MailBox) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	boxClient, unlock, err := r.selectedClient(from)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := r.selectWritable(boxClient, from); err != nil {
+		return err
+	}
+	hasMove, err := boxClient.Support("MOVE")
+	if err != nil {
+		return fmt.Errorf("check capability: %v", err)
+	}
+	if !hasMove {
+		if err := r.copyMessages(boxClient, uids, to); err != nil {
+			return err
+		}
+		return deleteMessages(boxClient, from, uids)
+	}
+	cmd := &commands.Uid{Cmd: &moveCommand{
+		SeqSet: uidSet(uids), Mailbox: r.mailboxName(to)}}
+	if err := execute(boxClient, cmd); err != nil {
+		return fmt.Errorf("move messages to %v: %v", to, err)
+	}
+	return nil
+}
+
+// SupportsSafeMove reports whether the server supports MOVE or UIDPLUS,
+// so MoveMessages and DeleteMessages only expunge the given messages
+func (r Retriever) SupportsSafeMove() (bool, error) {
+	cli, unlock, err := r.adminClient()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	for _, capability := range []string{"MOVE", "UIDPLUS"} {
+		ok, err := cli.Support(capability)
+		if err != nil {
+			return false, fmt.Errorf("check capability: %v", err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RescueFromSpam moves the messages from Spam to Inbox, see MoveMessages
+func (r Retriever) RescueFromSpam(uids ...uint32) error {
+	return r.MoveMessages(Spam, uids, Inbox)
+}
+
+// DeleteMessages flags the messages as \Deleted then expunges them,
+// if the server does not support UIDPLUS (RFC 4315), all messages flagged
+// as \Deleted in the box are expunged too
+func (r Retriever) DeleteMessages(box MailBox, uids ...uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	boxClient, unlock, err := r.selectedClient(box)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := r.selectWritable(boxClient, box); err != nil {
+		return err
+	}
+	return deleteMessages(boxClient, box, uids)
+}
+
+// deleteMessages needs the lock of the box connection
+func deleteMessages(boxClient *client.Client, box MailBox, uids []uint32) error {
+	err := boxClient.UidStore(uidSet(uids), imap.FormatFlagsOp(imap.AddFlags, true),
+		[]interface{}{FlagDeleted}, nil)
+	if err != nil {
+		return fmt.Errorf("store flags %v: %v", []string{FlagDeleted}, err)
+	}
+	hasUIDPlus, err := boxClient.Support("UIDPLUS")
+	if err != nil {
+		return fmt.Errorf("check capability: %v", err)
+	}
+	if !hasUIDPlus {
+		return expunge(boxClient, box)
+	}
+	if err := execute(boxClient, &uidExpungeCommand{SeqSet: uidSet(uids)}); err != nil {
+		return fmt.Errorf("uid expunge: %v", err)
+	}
+	return nil
+}
+
+// Expunge permanently removes all messages flagged as \Deleted in the box
+func (r Retriever) Expunge(box MailBox) error {
+	boxClient, unlock, err := r.selectedClient(box)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := r.selectWritable(boxClient, box); err != nil {
+		return err
+	}
+	return expunge(boxClient, box)
+}
+
+func expunge(boxClient *client.Client, box MailBox) error {
+	if err := boxClient.Expunge(nil); err != nil {
+		return fmt.Errorf("expunge %v: %v", box, err)
+	}
+	return nil
+}
+
+func uidSet(uids []uint32) *imap.SeqSet {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	return seqSet
+}
+
+// execute runs a command that go-imap client does not implement
+func execute(cli *client.Client, cmd imap.Commander) error {
+	status, err := cli.Execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// moveCommand is a MOVE command, as defined in RFC 6851 section 3.1
+type moveCommand struct {
+	SeqSet  *imap.SeqSet
+	Mailbox string
+}
+
+func (cmd *moveCommand) Command() *imap.Command {
+	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.Mailbox)
+	return &imap.Command{
+		Name:      "MOVE",
+		Arguments: []interface{}{cmd.SeqSet, imap.FormatMailboxName(mailbox)},
+	}
+}
+
+// uidExpungeCommand is a UID EXPUNGE command, as defined in RFC 4315 section 2.1
+type uidExpungeCommand struct {
+	SeqSet *imap.SeqSet
+}
+
+func (cmd *uidExpungeCommand) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "UID",
+		Arguments: []interface{}{imap.RawString("EXPUNGE"), cmd.SeqSet},
+	}
+}
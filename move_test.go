@@ -0,0 +1,92 @@
+package email
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	imap "github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+)
+
+func TestRetriever_MoveMessages(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	s.addMessage(t, "Spam", nil, time.Now(), "Subject: not spam\r\n\r\nhello")
+	s.addMessage(t, "Spam", nil, time.Now(), "Subject: spam\r\n\r\nprize")
+	r := s.retriever(t)
+	if err := r.CreateMailbox("Archive"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake server has neither MOVE nor UIDPLUS
+	if safe, err := r.SupportsSafeMove(); err != nil || safe {
+		t.Errorf("unexpected SupportsSafeMove: %v, %v", safe, err)
+	}
+	if err := r.RescueFromSpam(1); err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := r.RetrieveMails(SearchCriteria{Subject: "not spam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 1 || inbox[0].MailBox != Inbox || inbox[0].HasFlag(FlagDeleted) {
+		t.Fatalf("unexpected rescued messages: %#v", inbox)
+	}
+
+	if err := r.CopyMessages(Inbox, []uint32{6, inbox[0].UID}, MailBox("Archive")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteMessages(Spam, 2); err != nil {
+		t.Fatal(err)
+	}
+	boxes, err := r.ListMailboxes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]uint32)
+	for _, box := range boxes {
+		counts[box.Name] = box.Messages
+	}
+	if counts["INBOX"] != 2 || counts["Spam"] != 0 || counts["Archive"] != 2 {
+		t.Errorf("unexpected message counts: %v", counts)
+	}
+
+	if err := r.AddFlags(Inbox, []uint32{6}, FlagDeleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Expunge(Inbox); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := r.RetrieveMails(SearchCriteria{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Subject != "not spam" {
+		t.Errorf("unexpected messages after expunge: %#v", msgs)
+	}
+}
+
+func TestMoveCommand(t *testing.T) {
+	seqSet := uidSet([]uint32{3, 4, 5, 9})
+	for _, c := range []struct {
+		cmd      imap.Commander
+		expected string
+	}{
+		{&commands.Uid{Cmd: &moveCommand{SeqSet: seqSet, Mailbox: "[Gmail]/Spam"}},
+			"A1 UID MOVE 3:5,9 \"[Gmail]/Spam\"\r\n"},
+		{&commands.Uid{Cmd: &moveCommand{SeqSet: seqSet, Mailbox: "INBOX"}},
+			"A1 UID MOVE 3:5,9 INBOX\r\n"},
+		{&uidExpungeCommand{SeqSet: seqSet}, "A1 UID EXPUNGE 3:5,9\r\n"},
+	} {
+		buf := &bytes.Buffer{}
+		w := imap.NewWriter(buf)
+		cmd := c.cmd.Command()
+		cmd.Tag = "A1"
+		if err := cmd.WriteTo(w); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("unexpected command: real %q, expected %q", buf.String(), c.expected)
+		}
+	}
+}
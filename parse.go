@@ -0,0 +1,175 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	netmail "net/mail"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+)
+
+// wordDecoder decodes RFC 2047 encoded words in headers to UTF-8
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.Reader}
+
+// ParseMessage parses a raw RFC 5322 message such as an .eml file,
+// the fields that IMAP provides (MailBox, UID, Flags, InternalDate) are
+// empty, on a malformed message it returns the fields parsed so far and an
+// error that is also set to Message.ParseErr
+func ParseMessage(r io.Reader) (Message, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Message{}, fmt.Errorf("read message: %v", err)
+	}
+	msg := Message{Size: uint32(len(data)), raw: data}
+	msg.ParseErr = parseBody(data, &msg)
+	if msg.Header == nil {
+		return msg, msg.ParseErr
+	}
+	msg.Date, _ = netmail.ParseDate(msg.Header.Get("Date"))
+	addressParser := &netmail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := addressParser.ParseList(msg.Header.Get("From")); err == nil &&
+		len(from) > 0 {
+		msg.From, msg.FromName = from[0].Address, from[0].Name
+	}
+	msg.Subject = msg.Header.Get("Subject")
+	if subject, err := wordDecoder.DecodeHeader(msg.Subject); err == nil {
+		msg.Subject = subject
+	}
+	msg.MIMEType = TextPlain // RFC 2045 default
+	if mediaType, _, err := mime.ParseMediaType(
+		msg.Header.Get("Content-Type")); err == nil {
+		msg.MIMEType = MIMEType(mediaType)
+	}
+	return msg, msg.ParseErr
+}
+
+// Raw returns the original RFC 5322 bytes, nil if the message was not
+// fully downloaded (see WithFetchMode and WithMaxBytes)
+func (m Message) Raw() []byte {
+	return m.raw
+}
+
+// WriteTo writes the original RFC 5322 bytes, so a message can be archived
+// and parsed again later by ParseMessage
+func (m Message) WriteTo(w io.Writer) (int64, error) {
+	if m.raw == nil {
+		return 0, fmt.Errorf("raw message was not downloaded")
+	}
+	n, err := w.Write(m.raw)
+	return int64(n), err
+}
+
+// Part is a decoded leaf part of a message, such as the plain text or the
+// HTML alternative, an inline image or an attachment, see Message.Parts
+type Part struct {
+	MIMEType   MIMEType // example: TextPlain, TextHTML, "image/png"
+	Charset    string   // declared charset of a text part, Content is UTF-8
+	Attachment bool     // not meant to be displayed as the message body
+	Filename   string
+	ContentID  string // without angle brackets, referred by "cid:" URLs
+	Content    []byte
+}
+
+// Parts decodes all leaf parts of the raw message in order, the alternative
+// bodies of a multipart/alternative are all returned, on a malformed
+// message it returns the parts decoded so far and an error
+func (m Message) Parts() ([]Part, error) {
+	if m.raw == nil {
+		return nil, fmt.Errorf("raw message was not downloaded")
+	}
+	mailReader, err := mail.CreateReader(bytes.NewReader(m.raw))
+	if err := ignoreUnknownCharset(err); err != nil {
+		return nil, fmt.Errorf("mail CreateReader: %v", err)
+	}
+	ret := make([]Part, 0)
+	for {
+		part, err := mailReader.NextPart()
+		if err == io.EOF {
+			return ret, nil
+		} else if err := ignoreUnknownCharset(err); err != nil {
+			return ret, fmt.Errorf("mailReader NextPart: %v", err)
+		}
+		var header message.Header
+		p := Part{}
+		switch h := part.Header.(type) {
+		case *mail.InlineHeader:
+			header = h.Header
+		case *mail.AttachmentHeader:
+			header, p.Attachment = h.Header, true
+		}
+		p.MIMEType = TextPlain // RFC 2045 default
+		if mediaType, params, err := header.ContentType(); err == nil {
+			p.MIMEType, p.Charset = MIMEType(mediaType), strings.ToLower(params["charset"])
+		}
+		p.Filename, _ = (&mail.AttachmentHeader{Header: header}).Filename()
+		p.ContentID = strings.Trim(header.Get("Content-Id"), "<> ")
+		p.Content, err = ioutil.ReadAll(part.Body)
+		ret = append(ret, p)
+		if err != nil {
+			return ret, fmt.Errorf("read part: %v", err)
+		}
+	}
+}
+
+// ignoreUnknownCharset returns nil for an error of an unknown charset,
+// that is not an error, the text is kept undecoded
+func ignoreUnknownCharset(err error) error {
+	if message.IsUnknownCharset(err) {
+		return nil
+	}
+	return err
+}
+
+// parseBody reads the text part of a raw RFC 5322 message into msg Body,
+// MainPartMIMEType and Charset, HTML is preferred over plain text,
+// on a malformed message it returns an error and keeps the text read so far
+// or, if the header cannot be parsed, the undecoded body
+func parseBody(data []byte, msg *Message) error {
+	_ = parseHeader(bytes.NewReader(data), msg) // CreateReader checks the header
+	mailReader, err := mail.CreateReader(bytes.NewReader(data))
+	if err := ignoreUnknownCharset(err); err != nil {
+		if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+			data = data[i+4:]
+		}
+		msg.Body = string(data)
+		return fmt.Errorf("mail CreateReader: %v", err)
+	}
+	for { // loop through all parts but only care about text part
+		part, err := mailReader.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err := ignoreUnknownCharset(err); err != nil {
+			return fmt.Errorf("mailReader NextPart: %v", err)
+		}
+		header, ok := part.Header.(*mail.InlineHeader)
+		if !ok {
+			continue // ignore attachments: images, files, ..
+		}
+		// text/plain or text/html
+		mimeType := TextHTML
+		if strings.Contains(part.Header.Get("Content-Type"), "text/plain") {
+			if msg.MainPartMIMEType == TextHTML && msg.Body != "" {
+				// skip fetch plain text that is similar to fetched html
+				continue
+			}
+			mimeType = TextPlain
+		}
+		content, err := ioutil.ReadAll(part.Body)
+		if err != nil && len(content) == 0 && msg.Body != "" {
+			// keep the previous part
+			return fmt.Errorf("read part: %v", err)
+		}
+		_, params, _ := header.ContentType()
+		msg.Body, msg.MainPartMIMEType = string(content), mimeType
+		msg.Charset = strings.ToLower(params["charset"])
+		if err != nil {
+			return fmt.Errorf("read part: %v", err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBody_Malformed(t *testing.T) {
+	for i, c := range []struct {
+		raw  string
+		body string
+	}{
+		{"Content-Type: multipart/mixed; boundary=xyz\r\n\r\n--xyz\r\n" +
+			"Content-Type: text/plain\r\n\r\nhello\r\n--xyz\r\n" +
+			"Content-Type: text/html\r\nContent-Transfer-Encoding: base64\r\n\r\n!!!!",
+			"hello"},
+		{"Content-Type: multipart/mixed; boundary=xyz\r\n\r\n--xyz\r\n" +
+			"Content-Type: text/plain\r\n\r\nhello truncated", "hello truncated"},
+		{"Subject: a\r\nContent-Transfer-Encoding: x-bogus\r\n\r\nhello", "hello"},
+		{"Subject a\r\nbad header\r\n\r\nhello", "hello"},
+	} {
+		msg := Message{}
+		err := parseBody([]byte(c.raw), &msg)
+		if err == nil {
+			t.Errorf("case %v: expected error", i)
+		}
+		if msg.Body != c.body {
+			t.Errorf("case %v: real body %q, expected %q", i, msg.Body, c.body)
+		}
+	}
+}
+
+func TestRetriever_TolerantParsing(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	s.addMessage(t, "Spam", nil, time.Now(), "Subject: bad\r\n"+
+		"Content-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n!!!!")
+	msgs, err := s.retriever(t).RetrieveMails(SearchCriteria{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].ParseErr != nil || msgs[1].ParseErr == nil {
+		t.Errorf("unexpected messages: %#v", msgs)
+	}
+
+	_, err = s.retriever(t, WithStrictParsing()).RetrieveMails(SearchCriteria{})
+	if err == nil {
+		t.Errorf("expected error in strict mode")
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	raw := "Date: Mon, 07 Jun 2021 10:00:00 +0700\r\n" +
+		"From: =?UTF-8?Q?Nguy=E1=BB=85n?= <nguyen@example.com>\r\n" +
+		"Subject: =?GB2312?B?xOO6ww==?=\r\n" + testMultipartMessage[len("From: alice@example.com\r\nSubject: report\r\n"):]
+	msg, err := ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.From != "nguyen@example.com" || msg.FromName != "Nguyễn" ||
+		msg.Subject != "你好" || msg.Date.Unix() != 1623034800 ||
+		msg.MIMEType != "multipart/mixed" || msg.Body != "<p>Café</p>" ||
+		msg.Header.Get("X-Test") != "1" {
+		t.Errorf("unexpected message: %#v", msg)
+	}
+
+	archived := &strings.Builder{}
+	if _, err := msg.WriteTo(archived); err != nil {
+		t.Fatal(err)
+	}
+	if archived.String() != raw {
+		t.Errorf("unexpected archived message: %q", archived.String())
+	}
+
+	if _, err := ParseMessage(strings.NewReader("Subject a\r\n\r\nhi")); err == nil {
+		t.Errorf("expected error for a malformed header")
+	}
+}
+
+func TestRetriever_RawMessage(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	s.addMessage(t, "INBOX", nil, time.Now(), testMultipartMessage)
+	r := s.retriever(t)
+	msgs, err := r.RetrieveMails(SearchCriteria{Subject: "report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Raw()) != testMultipartMessage {
+		t.Fatalf("unexpected raw messages: %#v", msgs)
+	}
+	reparsed, err := ParseMessage(strings.NewReader(string(msgs[0].Raw())))
+	if err != nil || reparsed.Body != msgs[0].Body || reparsed.Subject != msgs[0].Subject {
+		t.Errorf("unexpected reparsed message: %#v, %v", reparsed, err)
+	}
+
+	msgs, err = r.RetrieveMails(SearchCriteria{Subject: "report"}, WithFetchMode(FetchText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := msgs[0].WriteTo(&strings.Builder{}); err == nil {
+		t.Errorf("expected error for a message without raw bytes")
+	}
+}
+
+func TestMessage_Parts(t *testing.T) {
+	msg, err := ParseMessage(strings.NewReader(testMultipartMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, err := msg.Parts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("unexpected parts: %#v", parts)
+	}
+	if parts[0].MIMEType != TextPlain || string(parts[0].Content) != "plain text" ||
+		parts[0].Attachment {
+		t.Errorf("unexpected plain text part: %#v", parts[0])
+	}
+	if parts[1].MIMEType != TextHTML || string(parts[1].Content) != "<p>Café</p>" ||
+		parts[1].Charset != "iso-8859-1" {
+		t.Errorf("unexpected html part: %#v", parts[1])
+	}
+	if !parts[2].Attachment || parts[2].Filename != "data.bin" ||
+		string(parts[2].Content) != "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09" {
+		t.Errorf("unexpected attachment: %#v", parts[2])
+	}
+
+	if _, err := (Message{}).Parts(); err == nil {
+		t.Errorf("expected error for a message without raw bytes")
+	}
+}
@@ -0,0 +1,220 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PoolStrategy decides which account of a SenderPool is tried first
+type PoolStrategy string
+
+// PoolStrategy enum
+const (
+	PoolRoundRobin PoolStrategy = "roundRobin"
+	PoolWeighted   PoolStrategy = "weighted" // smooth weighted round robin
+	PoolMostQuota  PoolStrategy = "mostQuota"
+)
+
+// PoolMember is an account in a SenderPool
+type PoolMember struct {
+	Sender *Sender
+	Weight int // only used by PoolWeighted, <= 0 means 1
+}
+
+// PoolSendResult tells which account sent an email
+type PoolSendResult struct {
+	Account string  // username of the Sender that sent the email
+	Errors  []error // errors of the accounts tried before failing over
+	// Warning is a SentCopyError of the account that sent the email
+	Warning error
+}
+
+// SenderPool spreads emails over several accounts and fails over to the
+// next account on auth, quota or connection errors
+type SenderPool struct {
+	strategy PoolStrategy
+	members  []PoolMember
+	// Cooldown is how long an account is skipped after a failover error,
+	// default 1 minute, a RateLimitError uses its RetryAt instead,
+	// must be set before sending
+	Cooldown time.Duration
+
+	mutex    *sync.Mutex // protect fields below
+	next     int         // round robin position
+	current  []int       // smooth weighted round robin state
+	cooldown []time.Time // skip member i until cooldown[i]
+}
+
+// NewSenderPool returns a pool of the given accounts
+func NewSenderPool(strategy PoolStrategy, members ...PoolMember) (
+	*SenderPool, error) {
+	if len(members) == 0 {
+		return nil, errors.New("empty sender pool")
+	}
+	for i, member := range members {
+		if member.Sender == nil {
+			return nil, fmt.Errorf("nil sender at index %v", i)
+		}
+		if member.Weight <= 0 {
+			members[i].Weight = 1
+		}
+	}
+	switch strategy {
+	case PoolRoundRobin, PoolWeighted, PoolMostQuota:
+	default:
+		return nil, fmt.Errorf("unknown pool strategy %v", strategy)
+	}
+	return &SenderPool{
+		strategy: strategy, members: members, Cooldown: time.Minute,
+		mutex:    &sync.Mutex{},
+		current:  make([]int, len(members)),
+		cooldown: make([]time.Time, len(members)),
+	}, nil
+}
+
+// SendMail implements MailSender so a SenderPool can be used by a Queue
+func (p *SenderPool) SendMail(targetEmail string, subject string,
+	contentType MIMEType, content string) error {
+	result, err := p.Send(targetEmail, subject, contentType, content)
+	if err == nil && result.Warning != nil {
+		return result.Warning // like Sender.SendMail
+	}
+	return err
+}
+
+// Send tries the accounts in the order of the pool strategy until one
+// sends the email or fails with an error that another account would also get
+// (such as an unknown recipient), accounts in cooldown are tried last,
+// a SentCopyError means the email was sent, it is returned as result.Warning
+func (p *SenderPool) Send(targetEmail string, subject string,
+	contentType MIMEType, content string) (PoolSendResult, error) {
+	var result PoolSendResult
+	var lastErr error
+	for _, i := range p.order() {
+		sender := p.members[i].Sender
+		err := sender.SendMail(targetEmail, subject, contentType, content)
+		var copyErr *SentCopyError
+		if err == nil || errors.As(err, &copyErr) {
+			result.Account, result.Warning = sender.Username(), err
+			return result, nil
+		}
+		lastErr = err
+		result.Errors = append(result.Errors, err)
+		if !IsFailoverError(err) {
+			break
+		}
+		p.startCooldown(i, err)
+	}
+	return result, lastErr
+}
+
+// IsFailoverError reports whether the error is specific to the sending
+// account or its connection so another account may succeed,
+// false if the email may have been delivered
+func IsFailoverError(err error) bool {
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) {
+		return true
+	}
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.MaybeDelivered {
+		return false
+	}
+	if sendErr.Stage == StageDial || sendErr.Stage == StageAuth {
+		return true
+	}
+	code := sendErr.Code()
+	if code == 0 {
+		return true // broken connection
+	}
+	if code >= 400 && code < 500 {
+		return true
+	}
+	// a permanent reply is usually about the message (size, recipient, ..),
+	// only an account quota or an account policy rejection is worth failover
+	var protoErr *textproto.Error
+	errors.As(sendErr.Err, &protoErr) // not nil because code is not 0
+	enhanced := enhancedStatusPattern.FindStringSubmatch(protoErr.Msg)
+	if enhanced == nil {
+		return false
+	}
+	if enhanced[1] == "4.5" { // 5.4.5 sending quota exceeded
+		return true
+	}
+	if !strings.HasPrefix(enhanced[1], "7.") { // security or policy status
+		return false
+	}
+	lowerMsg := strings.ToLower(protoErr.Msg)
+	for _, keyword := range []string{"quota", "limit", "too many"} {
+		if strings.Contains(lowerMsg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// enhancedStatusPattern matches the RFC 3463 status code of a 5xx reply,
+// example: "550 5.4.5 Daily user sending quota exceeded"
+var enhancedStatusPattern = regexp.MustCompile(`^5\.(\d{1,3}\.\d{1,3})\b`)
+
+func (p *SenderPool) startCooldown(i int, err error) {
+	until := time.Now().Add(p.Cooldown)
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) {
+		until = rateErr.RetryAt
+	}
+	p.mutex.Lock()
+	p.cooldown[i] = until
+	p.mutex.Unlock()
+}
+
+// order returns member indexes in the order they should be tried
+func (p *SenderPool) order() []int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	n := len(p.members)
+	ret := make([]int, 0, n)
+	switch p.strategy {
+	case PoolRoundRobin:
+		for k := 0; k < n; k++ {
+			ret = append(ret, (p.next+k)%n)
+		}
+		p.next = (p.next + 1) % n
+	case PoolWeighted:
+		total, best := 0, 0
+		for i, member := range p.members {
+			p.current[i] += member.Weight
+			total += member.Weight
+			if p.current[i] > p.current[best] {
+				best = i
+			}
+		}
+		p.current[best] -= total
+		for k := 0; k < n; k++ {
+			ret = append(ret, (best+k)%n)
+		}
+	case PoolMostQuota:
+		remaining := make([]int, n)
+		for i, member := range p.members {
+			remaining[i] = member.Sender.RemainingQuota().RemainingDay
+			if remaining[i] < 0 { // unlimited
+				remaining[i] = int(^uint(0) >> 1)
+			}
+			ret = append(ret, i)
+		}
+		sort.SliceStable(ret, func(a, b int) bool {
+			return remaining[ret[a]] > remaining[ret[b]]
+		})
+	}
+	now := time.Now()
+	sort.SliceStable(ret, func(a, b int) bool { // cooling down accounts last
+		return !p.cooldown[ret[a]].After(now) && p.cooldown[ret[b]].After(now)
+	})
+	return ret
+}
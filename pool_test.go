@@ -0,0 +1,125 @@
+package email
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+)
+
+func TestSenderPool_RoundRobinFailover(t *testing.T) {
+	down := newFakeSMTPServer(t, func(session int, cmd string) string {
+		if cmd == "CONNECT" {
+			return "421 service not available"
+		}
+		return ""
+	})
+	up := newFakeSMTPServer(t, nil)
+	sender0, sender1 := down.sender(), up.sender()
+	sender0.username, sender1.username = "down@example.com", "up@example.com"
+	pool, err := NewSenderPool(PoolRoundRobin,
+		PoolMember{Sender: &sender0}, PoolMember{Sender: &sender1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		result, err := pool.Send("target@example.com", "subject0", TextPlain, "content0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Account != "up@example.com" {
+			t.Errorf("unexpected account: %v", result.Account)
+		}
+		if i == 0 && len(result.Errors) != 1 {
+			t.Errorf("unexpected failover errors: %v", result.Errors)
+		}
+		if i > 0 && len(result.Errors) != 0 { // the down account is cooling down
+			t.Errorf("unexpected errors after cooldown: %v", result.Errors)
+		}
+	}
+	if n := len(up.receivedMessages()); n != 3 {
+		t.Errorf("unexpected received: real %v, expected %v", n, 3)
+	}
+}
+
+func TestSenderPool_NoFailoverOnRecipientError(t *testing.T) {
+	reject := func(session int, cmd string) string {
+		if cmd == "RCPT" {
+			return "550 5.1.1 no such user"
+		}
+		return ""
+	}
+	server0, server1 := newFakeSMTPServer(t, reject), newFakeSMTPServer(t, reject)
+	sender0, sender1 := server0.sender(), server1.sender()
+	pool, _ := NewSenderPool(PoolRoundRobin,
+		PoolMember{Sender: &sender0}, PoolMember{Sender: &sender1})
+	result, err := pool.Send("target@example.com", "subject0", TextPlain, "content0")
+	if err == nil || len(result.Errors) != 1 {
+		t.Errorf("unexpected result: %v, %v", result, err)
+	}
+	if n := server0.countSessions() + server1.countSessions(); n != 1 {
+		t.Errorf("unexpected sessions: real %v, expected %v", n, 1)
+	}
+}
+
+func TestSenderPool_SentCopyError(t *testing.T) {
+	imapServer := newFakeIMAPServer(t)
+	r := imapServer.retriever(t) // no sent mailbox so the copy fails
+	server0, server1 := newFakeSMTPServer(t, nil), newFakeSMTPServer(t, nil)
+	sender0, sender1 := server0.sender(), server1.sender()
+	sender0.username = "copy@example.com"
+	WithSentCopy(r)(&sender0)
+	pool, _ := NewSenderPool(PoolRoundRobin,
+		PoolMember{Sender: &sender0}, PoolMember{Sender: &sender1})
+	result, err := pool.Send("target@example.com", "subject0", TextPlain, "content0")
+	var copyErr *SentCopyError
+	if err != nil || result.Account != "copy@example.com" ||
+		!errors.As(result.Warning, &copyErr) || len(result.Errors) != 0 {
+		t.Errorf("unexpected result: %+v, %v", result, err)
+	}
+	if n := len(server0.receivedMessages()) + len(server1.receivedMessages()); n != 1 {
+		t.Errorf("unexpected received: real %v, expected %v", n, 1)
+	}
+}
+
+func TestSenderPool_order(t *testing.T) {
+	sender0, sender1 := Sender{username: "a"}, Sender{username: "b"}
+	pool, _ := NewSenderPool(PoolWeighted,
+		PoolMember{Sender: &sender0, Weight: 3}, PoolMember{Sender: &sender1})
+	counts := make(map[int]int)
+	for i := 0; i < 8; i++ {
+		counts[pool.order()[0]]++
+	}
+	if counts[0] != 6 || counts[1] != 2 {
+		t.Errorf("unexpected weighted counts: %v", counts)
+	}
+
+	WithSendLimit(SendLimit{PerDay: 10})(&sender0)
+	WithSendLimit(SendLimit{PerDay: 20})(&sender1)
+	pool, _ = NewSenderPool(PoolMostQuota,
+		PoolMember{Sender: &sender0}, PoolMember{Sender: &sender1})
+	if first := pool.order()[0]; first != 1 {
+		t.Errorf("unexpected most quota member: %v", first)
+	}
+}
+
+func TestIsFailoverError(t *testing.T) {
+	for i, c := range []struct {
+		code     int
+		msg      string
+		failover bool
+	}{
+		{421, "4.7.0 try again later", true},
+		{452, "4.5.3 too many recipients", true},
+		{550, "5.4.5 Daily user sending quota exceeded", true},
+		{550, "5.7.1 too many messages from this account", true},
+		{552, "message size exceeds fixed limit", false},
+		{552, "5.3.4 message size exceeds fixed limit", false},
+		{550, "5.1.1 no such user, mailbox limit", false},
+	} {
+		err := &SendError{Stage: StageDataEnd,
+			Err: &textproto.Error{Code: c.code, Msg: c.msg}}
+		if real := IsFailoverError(err); real != c.failover {
+			t.Errorf("case %v %v: real %v, expected %v", i, c.msg, real, c.failover)
+		}
+	}
+}
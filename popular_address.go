@@ -1,7 +1,13 @@
 package email
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Provider is a const string determines email provider,
-// this file has map provider name to their SMTP and IMAP server address
+// this file has a registry of provider connection profiles
 type Provider string
 
 // Provider enum
@@ -17,18 +23,334 @@ const (
 	// Zoho account need to enable IMAP at URL
 	// https://mail.zoho.com/zm/#settings/all/mailaccounts
 	ZohoMail Provider = "ZohoMail"
+
+	Outlook   Provider = "Outlook"   // personal Microsoft accounts
+	Office365 Provider = "Office365" // Microsoft 365 work or school accounts
+	Yahoo     Provider = "Yahoo"
+	// YahooJapan is Yahoo! JAPAN, a separate provider from Yahoo
+	YahooJapan Provider = "YahooJapan"
+	ICloud     Provider = "ICloud"
+	Yandex     Provider = "Yandex"
+	Fastmail   Provider = "Fastmail"
+	MailRu     Provider = "MailRu"
+	QQMail     Provider = "QQMail"
+	GMX        Provider = "GMX"    // international GMX: gmx.com, gmx.us, ..
+	GMXNet     Provider = "GMXNet" // German speaking GMX: gmx.net, gmx.de, ..
+)
+
+// TLSMode is how a connection is encrypted
+type TLSMode string
+
+// TLSMode enum
+const (
+	TLSImplicit TLSMode = "implicit" // TLS from the start, port 465 or 993
+	TLSStartTLS TLSMode = "starttls" // upgrade a plain connection, port 587 or 143
+	TLSNone     TLSMode = "none"
 )
 
-// SendingServers maps provider to SMTP host:port
+// Endpoint is a server address
+type Endpoint struct {
+	Host string
+	Port int
+	TLS  TLSMode
+}
+
+// Addr returns "host:port"
+func (e Endpoint) Addr() string {
+	return fmt.Sprintf("%v:%v", e.Host, e.Port)
+}
+
+// usableBySender reports whether NewSender connects to the SMTP endpoint
+// as it requires: implicit TLS on port 465, STARTTLS on other ports
+func (e Endpoint) usableBySender() bool {
+	return e.TLS == TLSImplicit && e.Port == 465 ||
+		e.TLS == TLSStartTLS && e.Port != 465
+}
+
+// usableByRetriever reports whether NewRetriever connects to the IMAP
+// endpoint as it requires: STARTTLS on port 143, implicit TLS on other ports
+func (e Endpoint) usableByRetriever() bool {
+	return e.TLS == TLSStartTLS && e.Port == 143 ||
+		e.TLS == TLSImplicit && e.Port != 143
+}
+
+// SpecialFolders are provider mailbox names, servers that support the
+// SPECIAL-USE extension also mark them with attributes such as \Sent,
+// empty means unknown
+type SpecialFolders struct {
+	Sent    string
+	Drafts  string
+	Trash   string
+	Spam    string
+	Archive string
+}
+
+// ProviderProfile is everything needed to connect to an email provider
+type ProviderProfile struct {
+	Provider Provider
+	SMTP     Endpoint
+	IMAP     Endpoint
+	// AuthMechanisms are SASL mechanisms the servers accept, such as
+	// "PLAIN", "LOGIN", "XOAUTH2"
+	AuthMechanisms []string
+	Folders        SpecialFolders
+	SendLimit      SendLimit
+	// AppPasswordNote tells what an account must do before a third-party
+	// app can log in with a password
+	AppPasswordNote string
+	// Domains are email domains hosted by the provider
+	Domains []string
+	// DomainPrefixes match domains in the Domains list that start with
+	// one of the prefixes, example: "yahoo." matches "yahoo.co.uk",
+	// a domain in the Domains of another profile is matched there first
+	DomainPrefixes []string
+}
+
+// Profiles is the provider registry, callers can add or replace profiles
+// before creating Senders and Retrievers
+var Profiles = map[Provider]ProviderProfile{
+	AOLMail: {
+		Provider:        AOLMail,
+		SMTP:            Endpoint{"smtp.aol.com", 465, TLSImplicit},
+		IMAP:            Endpoint{"imap.aol.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN", "XOAUTH2"},
+		Folders:         SpecialFolders{Sent: "Sent", Drafts: "Draft", Trash: "Trash", Spam: "Bulk Mail", Archive: "Archive"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 100},
+		AppPasswordNote: "create an app password at https://login.aol.com/account/security/app-passwords/list",
+		Domains:         []string{"aol.com", "aim.com", "love.com", "ygm.com", "games.com", "wow.com"},
+		DomainPrefixes:  []string{"aol."},
+	},
+	GMail: {
+		Provider:        GMail,
+		SMTP:            Endpoint{"smtp.gmail.com", 587, TLSStartTLS},
+		IMAP:            Endpoint{"imap.gmail.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN", "XOAUTH2", "OAUTHBEARER"},
+		Folders:         SpecialFolders{Sent: "[Gmail]/Sent Mail", Drafts: "[Gmail]/Drafts", Trash: "[Gmail]/Trash", Spam: "[Gmail]/Spam", Archive: "[Gmail]/All Mail"},
+		SendLimit:       SendLimit{PerMinute: 20, PerDay: 500},
+		AppPasswordNote: "enable 2-Step Verification then create an app password at https://myaccount.google.com/apppasswords",
+		Domains:         []string{"gmail.com", "googlemail.com"},
+	},
+	ZohoMail: {
+		Provider:        ZohoMail,
+		SMTP:            Endpoint{"smtp.zoho.com", 465, TLSImplicit},
+		IMAP:            Endpoint{"imap.zoho.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN"},
+		Folders:         SpecialFolders{Sent: "Sent", Drafts: "Drafts", Trash: "Trash", Spam: "Spam"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 50},
+		AppPasswordNote: "enable IMAP access at https://mail.zoho.com/zm/#settings/all/mailaccounts, accounts with 2FA need an application-specific password",
+		Domains:         []string{"zoho.com", "zohomail.com"},
+	},
+	Outlook: {
+		Provider:        Outlook,
+		SMTP:            Endpoint{"smtp-mail.outlook.com", 587, TLSStartTLS},
+		IMAP:            Endpoint{"outlook.office365.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"XOAUTH2", "LOGIN"},
+		Folders:         SpecialFolders{Sent: "Sent", Drafts: "Drafts", Trash: "Deleted", Spam: "Junk", Archive: "Archive"},
+		SendLimit:       SendLimit{PerMinute: 30, PerDay: 300},
+		AppPasswordNote: "basic auth is being retired, accounts with 2-step verification need an app password from https://account.live.com/proofs/AppPassword",
+		Domains:         []string{"outlook.com", "hotmail.com", "live.com", "msn.com", "passport.com"},
+		DomainPrefixes:  []string{"outlook.", "hotmail.", "live."},
+	},
+	Office365: {
+		Provider:        Office365,
+		SMTP:            Endpoint{"smtp.office365.com", 587, TLSStartTLS},
+		IMAP:            Endpoint{"outlook.office365.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"XOAUTH2", "LOGIN"},
+		Folders:         SpecialFolders{Sent: "Sent Items", Drafts: "Drafts", Trash: "Deleted Items", Spam: "Junk Email", Archive: "Archive"},
+		SendLimit:       SendLimit{PerMinute: 30, PerDay: 10000},
+		AppPasswordNote: "the tenant admin must enable SMTP AUTH for the mailbox, OAuth2 is recommended",
+	},
+	Yahoo: {
+		Provider:        Yahoo,
+		SMTP:            Endpoint{"smtp.mail.yahoo.com", 465, TLSImplicit},
+		IMAP:            Endpoint{"imap.mail.yahoo.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN", "XOAUTH2"},
+		Folders:         SpecialFolders{Sent: "Sent", Drafts: "Draft", Trash: "Trash", Spam: "Bulk", Archive: "Archive"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 500},
+		AppPasswordNote: "generate an app password at https://login.yahoo.com/account/security",
+		Domains:         []string{"ymail.com", "rocketmail.com"},
+		DomainPrefixes:  []string{"yahoo."},
+	},
+	YahooJapan: {
+		Provider:        YahooJapan,
+		SMTP:            Endpoint{"smtp.mail.yahoo.co.jp", 465, TLSImplicit},
+		IMAP:            Endpoint{"imap.mail.yahoo.co.jp", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN"},
+		AppPasswordNote: "enable IMAP and SMTP access in the Yahoo! Mail settings",
+		Domains:         []string{"yahoo.co.jp"},
+	},
+	ICloud: {
+		Provider:        ICloud,
+		SMTP:            Endpoint{"smtp.mail.me.com", 587, TLSStartTLS},
+		IMAP:            Endpoint{"imap.mail.me.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN"},
+		Folders:         SpecialFolders{Sent: "Sent Messages", Drafts: "Drafts", Trash: "Deleted Messages", Spam: "Junk", Archive: "Archive"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 1000},
+		AppPasswordNote: "create an app-specific password at https://appleid.apple.com, the SMTP username is the full address",
+		Domains:         []string{"icloud.com", "me.com", "mac.com"},
+	},
+	Yandex: {
+		Provider:        Yandex,
+		SMTP:            Endpoint{"smtp.yandex.com", 465, TLSImplicit},
+		IMAP:            Endpoint{"imap.yandex.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN", "XOAUTH2"},
+		Folders:         SpecialFolders{Sent: "Sent", Drafts: "Drafts", Trash: "Trash", Spam: "Spam"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 500},
+		AppPasswordNote: "allow IMAP in mail settings and create an app password at https://id.yandex.com/security/app-passwords",
+		Domains:         []string{"ya.ru", "narod.ru"},
+		DomainPrefixes:  []string{"yandex."},
+	},
+	Fastmail: {
+		Provider:        Fastmail,
+		SMTP:            Endpoint{"smtp.fastmail.com", 465, TLSImplicit},
+		IMAP:            Endpoint{"imap.fastmail.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN", "XOAUTH2"},
+		Folders:         SpecialFolders{Sent: "Sent", Drafts: "Drafts", Trash: "Trash", Spam: "Spam", Archive: "Archive"},
+		SendLimit:       SendLimit{PerMinute: 30, PerDay: 4000},
+		AppPasswordNote: "create an app password at Settings, Privacy & Security, Integrations",
+		Domains:         []string{"fastmail.com", "fastmail.fm", "fastmail.cn", "fastmail.in", "fastmail.net", "fastmail.to", "fastmail.us", "messagingengine.com"},
+	},
+	MailRu: {
+		Provider:       MailRu,
+		SMTP:           Endpoint{"smtp.mail.ru", 465, TLSImplicit},
+		IMAP:           Endpoint{"imap.mail.ru", 993, TLSImplicit},
+		AuthMechanisms: []string{"PLAIN", "LOGIN"},
+		// folders have Russian names, rely on SPECIAL-USE attributes
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 300},
+		AppPasswordNote: "create a password for external applications at https://account.mail.ru/user/2-step-auth/passwords",
+		Domains:         []string{"mail.ru", "inbox.ru", "list.ru", "bk.ru", "internet.ru", "mail.ua"},
+	},
+	QQMail: {
+		Provider:        QQMail,
+		SMTP:            Endpoint{"smtp.qq.com", 465, TLSImplicit},
+		IMAP:            Endpoint{"imap.qq.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN"},
+		Folders:         SpecialFolders{Sent: "Sent Messages", Drafts: "Drafts", Trash: "Deleted Messages", Spam: "Junk"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 500},
+		AppPasswordNote: "enable IMAP/SMTP in mail settings and use the generated authorization code as the password",
+		Domains:         []string{"qq.com", "vip.qq.com", "foxmail.com"},
+	},
+	GMX: {
+		Provider:        GMX,
+		SMTP:            Endpoint{"mail.gmx.com", 587, TLSStartTLS},
+		IMAP:            Endpoint{"imap.gmx.com", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN"},
+		Folders:         SpecialFolders{Sent: "Sent", Drafts: "Drafts", Trash: "Trash", Spam: "Spam"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 100},
+		AppPasswordNote: "enable POP3 and IMAP access in the mail settings",
+		Domains:         []string{"gmx.com", "gmx.us", "gmx.co.uk", "gmx.fr", "gmx.es"},
+	},
+	GMXNet: {
+		Provider:        GMXNet,
+		SMTP:            Endpoint{"mail.gmx.net", 587, TLSStartTLS},
+		IMAP:            Endpoint{"imap.gmx.net", 993, TLSImplicit},
+		AuthMechanisms:  []string{"PLAIN", "LOGIN"},
+		Folders:         SpecialFolders{Sent: "Gesendet", Drafts: "Entwürfe", Trash: "Papierkorb", Spam: "Spamverdacht"},
+		SendLimit:       SendLimit{PerMinute: 10, PerDay: 100},
+		AppPasswordNote: "enable POP3 and IMAP access in the mail settings",
+		Domains:         []string{"gmx.net", "gmx.de", "gmx.at", "gmx.ch"},
+	},
+}
+
+// SendingServers maps provider to SMTP host:port,
+// kept for compatibility, Profiles has more details
 var SendingServers = map[Provider]string{
-	AOLMail:  "smtp.aol.com:465",
-	GMail:    "smtp.gmail.com:587",
-	ZohoMail: "smtp.zoho.com:465",
+	AOLMail:  Profiles[AOLMail].SMTP.Addr(),
+	GMail:    Profiles[GMail].SMTP.Addr(),
+	ZohoMail: Profiles[ZohoMail].SMTP.Addr(),
 }
 
-// RetrievingServers maps provider to IMAP host:port
+// RetrievingServers maps provider to IMAP host:port,
+// kept for compatibility, Profiles has more details
 var RetrievingServers = map[Provider]string{
-	AOLMail:  "imap.aol.com:993",
-	GMail:    "imap.gmail.com:993",
-	ZohoMail: "imap.zoho.com:993",
+	AOLMail:  Profiles[AOLMail].IMAP.Addr(),
+	GMail:    Profiles[GMail].IMAP.Addr(),
+	ZohoMail: Profiles[ZohoMail].IMAP.Addr(),
+}
+
+// ProviderForAddress returns the profile of the provider that hosts the
+// address domain, example: "x@yahoo.com" returns Profiles[Yahoo],
+// a domain matches a profile by its Domains or by its DomainPrefixes if
+// the domain is in the known Domains list
+func ProviderForAddress(address string) (ProviderProfile, bool) {
+	at := strings.LastIndex(address, "@")
+	domain := strings.ToLower(strings.TrimSpace(address[at+1:]))
+	for _, profile := range orderedProfiles() {
+		for _, d := range profile.Domains {
+			if d == domain {
+				return profile, true
+			}
+		}
+	}
+	if !isKnownDomain(domain) {
+		return ProviderProfile{}, false
+	}
+	for _, profile := range orderedProfiles() {
+		for _, prefix := range profile.DomainPrefixes {
+			if strings.HasPrefix(domain, prefix) {
+				return profile, true
+			}
+		}
+	}
+	return ProviderProfile{}, false
+}
+
+// providerOrder is the order profiles are matched in, so a lookup returns
+// the same profile in every run, providers added to Profiles by callers
+// are matched after these in name order
+var providerOrder = []Provider{AOLMail, GMail, ZohoMail, Outlook, Office365,
+	Yahoo, YahooJapan, ICloud, Yandex, Fastmail, MailRu, QQMail, GMX, GMXNet}
+
+// orderedProfiles returns Profiles in providerOrder
+func orderedProfiles() []ProviderProfile {
+	ret := make([]ProviderProfile, 0, len(Profiles))
+	known := make(map[Provider]bool)
+	for _, provider := range providerOrder {
+		known[provider] = true
+		if profile, found := Profiles[provider]; found {
+			ret = append(ret, profile)
+		}
+	}
+	added := make([]Provider, 0)
+	for provider := range Profiles {
+		if !known[provider] {
+			added = append(added, provider)
+		}
+	}
+	sort.Slice(added, func(i int, j int) bool { return added[i] < added[j] })
+	for _, provider := range added {
+		ret = append(ret, Profiles[provider])
+	}
+	return ret
+}
+
+// profileForSMTP returns the first profile whose SMTP endpoint is the address
+func profileForSMTP(providerAddrSMTP string) (ProviderProfile, bool) {
+	for _, profile := range orderedProfiles() {
+		if profile.SMTP.Addr() == providerAddrSMTP {
+			return profile, true
+		}
+	}
+	return ProviderProfile{}, false
+}
+
+// profilesForIMAP returns the profiles whose IMAP endpoint is the address,
+// several providers can share a server, example: Outlook and Office365
+func profilesForIMAP(providerAddrIMAP string) []ProviderProfile {
+	ret := make([]ProviderProfile, 0)
+	for _, profile := range orderedProfiles() {
+		if profile.IMAP.Addr() == providerAddrIMAP {
+			ret = append(ret, profile)
+		}
+	}
+	return ret
+}
+
+func isKnownDomain(domain string) bool {
+	for _, d := range Domains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,64 @@
+package email
+
+import (
+	"testing"
+)
+
+func TestProviderForAddress(t *testing.T) {
+	for address, expected := range map[string]Provider{
+		"x@gmail.com":         GMail,
+		"x@GoogleMail.com":    GMail,
+		"x@yahoo.com":         Yahoo,
+		"x@yahoo.co.jp":       YahooJapan,
+		"x@yahoo.co.uk":       Yahoo,
+		"x@ymail.com":         Yahoo,
+		"x@hotmail.fr":        Outlook,
+		"x@live.com.mx":       Outlook,
+		"x@outlook.com.br":    Outlook,
+		"x@me.com":            ICloud,
+		"x@yandex.ru":         Yandex,
+		"x@fastmail.fm":       Fastmail,
+		"x@bk.ru":             MailRu,
+		"x@foxmail.com":       QQMail,
+		"x@gmx.fr":            GMX,
+		"x@gmx.de":            GMXNet,
+		"x@aol.it":            AOLMail,
+		"x@zohomail.com":      ZohoMail,
+		"x@yahoo.example.com": "",
+		"x@example.com":       "",
+	} {
+		profile, found := ProviderForAddress(address)
+		if found != (expected != "") || profile.Provider != expected {
+			t.Errorf("ProviderForAddress(%v): real %v %v, expected %v",
+				address, profile.Provider, found, expected)
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	for provider, profile := range Profiles {
+		if profile.Provider != provider {
+			t.Errorf("profile %v has Provider %v", provider, profile.Provider)
+		}
+		if profile.SMTP.Host == "" || profile.IMAP.Host == "" {
+			t.Errorf("profile %v misses endpoints", provider)
+		}
+		if !profile.SMTP.usableBySender() || !profile.IMAP.usableByRetriever() {
+			t.Errorf("profile %v has endpoints NewSender or NewRetriever cannot use",
+				provider)
+		}
+	}
+	if len(orderedProfiles()) != len(Profiles) || len(providerOrder) != len(Profiles) {
+		t.Errorf("providerOrder misses profiles: %v", providerOrder)
+	}
+	for i := 0; i < 20; i++ { // map iteration order is random
+		shared := profilesForIMAP("outlook.office365.com:993")
+		if len(shared) != 2 || shared[0].Provider != Outlook ||
+			shared[1].Provider != Office365 {
+			t.Fatalf("unexpected profiles of a shared server: %v", shared)
+		}
+	}
+	if SendingServers[GMail] != "smtp.gmail.com:587" {
+		t.Errorf("unexpected SendingServers: %v", SendingServers)
+	}
+}
@@ -0,0 +1,520 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailSender is the sending part of Sender, implemented by Sender and
+// other types that deliver emails on behalf of a Sender
+type MailSender interface {
+	SendMail(targetEmail string, subject string, contentType MIMEType,
+		content string) error
+}
+
+// MessageStatus is the delivery state of a message in a Queue
+type MessageStatus string
+
+// MessageStatus enum
+const (
+	StatusQueued  MessageStatus = "queued"  // waiting for the first attempt or a retry
+	StatusSending MessageStatus = "sending" // a worker is sending
+	StatusSent    MessageStatus = "sent"    // the server accepted the message
+	StatusFailed  MessageStatus = "failed"  // the server rejected the message permanently
+	// StatusDeadLettered means out of attempts or the message may have been
+	// delivered by a broken attempt, only Queue.Requeue can send it again
+	StatusDeadLettered MessageStatus = "dead-lettered"
+)
+
+// QueuedMessage is an outgoing email and its delivery state
+type QueuedMessage struct {
+	ID          string
+	TargetEmail string
+	Subject     string
+	ContentType MIMEType
+	Content     string
+
+	Status        MessageStatus
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	NextAttemptAt time.Time
+}
+
+// QueueStore persists queued messages, must be safe for concurrent use
+type QueueStore interface {
+	Save(msg QueuedMessage) error // create or replace the message with the same ID
+	Delete(id string) error
+	List() ([]QueuedMessage, error)
+}
+
+// QueueConfig configures a Queue
+type QueueConfig struct {
+	Workers int // number of goroutines that send, default 1
+	// Retry decides when a message is dead-lettered and the waits between
+	// attempts, default DefaultRetryPolicy, AttemptTimeout is ignored
+	// (the Sender's own policy applies to each attempt)
+	Retry RetryPolicy
+	// KeepSent is how long a sent message stays in the queue and the store
+	// so Status can report it, default 24 hours, negative removes the
+	// message right after sending, failed and dead-lettered messages stay
+	// until Requeue or Remove
+	KeepSent time.Duration
+}
+
+// Queue persists outgoing emails before sending so they survive crashes
+// and restarts, delivery is at least once: a message that was being sent
+// when the process died will be sent again
+type Queue struct {
+	sender MailSender
+	store  QueueStore
+	config QueueConfig
+
+	mutex *sync.Mutex // protect items, wakeup and stop
+	items map[string]*QueuedMessage
+	// wakeup is closed then replaced when a message becomes due,
+	// so all idle workers check the queue
+	wakeup   chan struct{}
+	stop     chan struct{}
+	stopOnce *sync.Once
+	wg       *sync.WaitGroup
+}
+
+// NewQueue loads unfinished messages from the store,
+// call Start to begin delivering
+func NewQueue(sender MailSender, store QueueStore, config QueueConfig) (
+	*Queue, error) {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.Retry.MaxAttempts <= 0 {
+		config.Retry = DefaultRetryPolicy
+	}
+	if config.KeepSent == 0 {
+		config.KeepSent = 24 * time.Hour
+	}
+	q := &Queue{
+		sender: sender, store: store, config: config,
+		mutex:    &sync.Mutex{},
+		items:    make(map[string]*QueuedMessage),
+		wakeup:   make(chan struct{}),
+		stop:     make(chan struct{}),
+		stopOnce: &sync.Once{},
+		wg:       &sync.WaitGroup{},
+	}
+	msgs, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("list queue store: %v", err)
+	}
+	for _, msg := range msgs {
+		msg := msg
+		if msg.Status == StatusSending { // interrupted by a crash
+			msg.Status = StatusQueued
+			if err := store.Save(msg); err != nil {
+				return nil, fmt.Errorf("save queue store: %v", err)
+			}
+		}
+		q.items[msg.ID] = &msg
+	}
+	return q, nil
+}
+
+// Start runs the workers, they stop when Stop is called,
+// a stopped Queue can be started again
+func (q *Queue) Start() {
+	q.mutex.Lock()
+	select {
+	case <-q.stop:
+		q.stop, q.stopOnce = make(chan struct{}), &sync.Once{}
+	default:
+	}
+	stop := q.stop
+	q.mutex.Unlock()
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.work(stop)
+		}()
+	}
+}
+
+// Stop waits for in-flight sends to finish then stops the workers,
+// queued messages stay in the store for the next run,
+// calling Stop more than once is safe
+func (q *Queue) Stop() {
+	q.mutex.Lock()
+	stop, stopOnce := q.stop, q.stopOnce
+	q.mutex.Unlock()
+	stopOnce.Do(func() { close(stop) })
+	q.wg.Wait()
+}
+
+// Enqueue returns after the message was persisted in the store,
+// returned ID can be used to check the delivery status
+func (q *Queue) Enqueue(targetEmail string, subject string,
+	contentType MIMEType, content string) (string, error) {
+	now := time.Now()
+	msg := QueuedMessage{
+		ID:          fmt.Sprintf("%019d-%08x", now.UnixNano(), rand.Uint32()),
+		TargetEmail: targetEmail, Subject: subject,
+		ContentType: contentType, Content: content,
+		Status: StatusQueued, CreatedAt: now, UpdatedAt: now,
+	}
+	q.mutex.Lock()
+	err := q.store.Save(msg)
+	if err == nil {
+		item := msg // workers update the item, msg is still read below
+		q.items[msg.ID] = &item
+		q.notify()
+	}
+	q.mutex.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("save queue store: %v", err)
+	}
+	return msg.ID, nil
+}
+
+// ErrMessageNotFound is returned for an unknown queued message ID
+var ErrMessageNotFound = errors.New("message not found")
+
+// Status returns a copy of the queued message
+func (q *Queue) Status(id string) (QueuedMessage, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	msg, found := q.items[id]
+	if !found {
+		return QueuedMessage{}, ErrMessageNotFound
+	}
+	return *msg, nil
+}
+
+// List returns messages that have the status (all messages if status is
+// empty), sorted by creation time
+func (q *Queue) List(status MessageStatus) []QueuedMessage {
+	q.mutex.Lock()
+	ret := make([]QueuedMessage, 0)
+	for _, msg := range q.items {
+		if status == "" || msg.Status == status {
+			ret = append(ret, *msg)
+		}
+	}
+	q.mutex.Unlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// Requeue resets a failed or dead-lettered message so it will be sent again
+func (q *Queue) Requeue(id string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	msg, found := q.items[id]
+	if !found {
+		return ErrMessageNotFound
+	}
+	if msg.Status != StatusFailed && msg.Status != StatusDeadLettered {
+		return fmt.Errorf("cannot requeue a %v message", msg.Status)
+	}
+	updated := *msg
+	updated.Status, updated.Attempts = StatusQueued, 0
+	updated.NextAttemptAt, updated.UpdatedAt = time.Time{}, time.Now()
+	if err := q.store.Save(updated); err != nil {
+		return fmt.Errorf("save queue store: %v", err)
+	}
+	*msg = updated
+	q.notify()
+	return nil
+}
+
+// Remove deletes a message that is not being sent from the queue and the store
+func (q *Queue) Remove(id string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	msg, found := q.items[id]
+	if !found {
+		return ErrMessageNotFound
+	}
+	if msg.Status == StatusSending {
+		return fmt.Errorf("cannot remove a %v message", msg.Status)
+	}
+	if err := q.store.Delete(id); err != nil {
+		return fmt.Errorf("delete queue store: %v", err)
+	}
+	delete(q.items, id)
+	return nil
+}
+
+// notify wakes all idle workers, q.mutex must be held
+func (q *Queue) notify() {
+	close(q.wakeup)
+	q.wakeup = make(chan struct{})
+}
+
+func (q *Queue) work(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		msg, wait, wakeup := q.claimNext()
+		if msg != nil {
+			q.deliver(*msg)
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-wakeup:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// claimNext marks the oldest due message as sending and returns it,
+// or returns how long to wait for the next due message and the channel
+// that is closed if a message becomes due before that,
+// it also removes the sent messages older than KeepSent
+func (q *Queue) claimNext() (*QueuedMessage, time.Duration, <-chan struct{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := time.Now()
+	wait := time.Minute
+	var next *QueuedMessage
+	for id, msg := range q.items {
+		if msg.Status == StatusSent && now.Sub(msg.UpdatedAt) >= q.config.KeepSent {
+			if err := q.store.Delete(id); err == nil { // else retry next time
+				delete(q.items, id)
+			}
+			continue
+		}
+		if msg.Status != StatusQueued {
+			continue
+		}
+		if msg.NextAttemptAt.After(now) {
+			if d := msg.NextAttemptAt.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+		if next == nil || msg.ID < next.ID {
+			next = msg
+		}
+	}
+	if next == nil {
+		return nil, wait, q.wakeup
+	}
+	claimed := *next
+	claimed.Status, claimed.UpdatedAt = StatusSending, now
+	if err := q.store.Save(claimed); err != nil {
+		// cannot persist, sending now could lead to a lost status
+		return nil, time.Second, q.wakeup
+	}
+	*next = claimed
+	return &claimed, 0, q.wakeup
+}
+
+func (q *Queue) deliver(msg QueuedMessage) {
+	err := q.sender.SendMail(msg.TargetEmail, msg.Subject, msg.ContentType, msg.Content)
+	now := time.Now()
+	msg.UpdatedAt = now
+	msg.NextAttemptAt = time.Time{}
+	var rateErr *RateLimitError
+	var sendErr *SendError
+	var copyErr *SentCopyError
+	switch {
+	case err == nil:
+		msg.Attempts++
+		msg.Status, msg.LastError = StatusSent, ""
+	case errors.As(err, &copyErr):
+		msg.Attempts++
+		msg.Status, msg.LastError = StatusSent, err.Error()
+	case errors.As(err, &rateErr): // not an attempt, wait for the quota
+		msg.Status, msg.LastError = StatusQueued, err.Error()
+		msg.NextAttemptAt = rateErr.RetryAt
+	default:
+		msg.Attempts++
+		msg.LastError = err.Error()
+		switch {
+		case errors.As(err, &sendErr) && sendErr.MaybeDelivered:
+			msg.Status = StatusDeadLettered
+		case errors.As(err, &sendErr) && !sendErr.Temporary():
+			msg.Status = StatusFailed
+		case msg.Attempts >= q.config.Retry.MaxAttempts:
+			msg.Status = StatusDeadLettered
+		default:
+			msg.Status = StatusQueued
+			msg.NextAttemptAt = now.Add(q.config.Retry.backoff(msg.Attempts))
+		}
+	}
+	q.mutex.Lock()
+	// keep going even if the store fails, the message will be resent
+	// after a restart because its stored status is still sending
+	if msg.Status == StatusSent && q.config.KeepSent < 0 {
+		if q.store.Delete(msg.ID) == nil {
+			delete(q.items, msg.ID)
+		} else {
+			_ = q.store.Save(msg) // claimNext removes it later
+		}
+	} else {
+		_ = q.store.Save(msg)
+	}
+	if item, found := q.items[msg.ID]; found {
+		*item = msg
+	}
+	q.mutex.Unlock()
+}
+
+// DirStore is a QueueStore that keeps each message in a JSON file
+type DirStore struct {
+	dir   string
+	mutex *sync.Mutex
+}
+
+// NewDirStore creates the directory if it does not exist and removes the
+// temporary files left by a crash during Save
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	leftovers, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if err != nil {
+		return nil, err
+	}
+	for _, leftover := range leftovers {
+		if err := os.Remove(leftover); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return &DirStore{dir: dir, mutex: &sync.Mutex{}}, nil
+}
+
+func (s *DirStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Save writes to a temporary file then renames it, so a crash never
+// leaves a partially written message
+func (s *DirStore) Save(msg QueuedMessage) error {
+	data, err := json.MarshalIndent(msg, "", "\t")
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tmp, err := ioutil.TempFile(s.dir, msg.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(msg.ID)); err != nil {
+		return err
+	}
+	// the rename is durable only after the directory is synced
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Delete removes the message file, deleting a missing message is not an error
+func (s *DirStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List reads all message files in the directory
+func (s *DirStore) List() ([]QueuedMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]QueuedMessage, 0)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var msg QueuedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("unmarshal %v: %v", file.Name(), err)
+		}
+		ret = append(ret, msg)
+	}
+	return ret, nil
+}
+
+// MemoryStore is a QueueStore that does not survive restarts,
+// useful for tests
+type MemoryStore struct {
+	mutex *sync.Mutex
+	msgs  map[string]QueuedMessage
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{mutex: &sync.Mutex{}, msgs: make(map[string]QueuedMessage)}
+}
+
+// Save implements QueueStore
+func (s *MemoryStore) Save(msg QueuedMessage) error {
+	s.mutex.Lock()
+	s.msgs[msg.ID] = msg
+	s.mutex.Unlock()
+	return nil
+}
+
+// Delete implements QueueStore
+func (s *MemoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	delete(s.msgs, id)
+	s.mutex.Unlock()
+	return nil
+}
+
+// List implements QueueStore
+func (s *MemoryStore) List() ([]QueuedMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := make([]QueuedMessage, 0, len(s.msgs))
+	for _, msg := range s.msgs {
+		ret = append(ret, msg)
+	}
+	return ret, nil
+}
@@ -0,0 +1,219 @@
+package email
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sendMailFunc func(targetEmail string, subject string,
+	contentType MIMEType, content string) error
+
+func (f sendMailFunc) SendMail(targetEmail string, subject string,
+	contentType MIMEType, content string) error {
+	return f(targetEmail, subject, contentType, content)
+}
+
+func waitForStatus(t *testing.T, q *Queue, id string, status MessageStatus) QueuedMessage {
+	for i := 0; i < 200; i++ {
+		msg, err := q.Status(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Status == status {
+			return msg
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	msg, _ := q.Status(id)
+	t.Fatalf("unexpected status: real %v, expected %v", msg.Status, status)
+	return msg
+}
+
+func TestQueue_RetryThenSent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "email_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex, calls := &sync.Mutex{}, 0
+	sender := sendMailFunc(func(string, string, MIMEType, string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		if calls < 3 {
+			return &SendError{Stage: StageDial, Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+		}
+		return nil
+	})
+	q, err := NewQueue(sender, store, QueueConfig{Workers: 2,
+		Retry: RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	defer q.Stop()
+	id, err := q.Enqueue("target@example.com", "subject0", TextPlain, "content0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := waitForStatus(t, q, id, StatusSent)
+	if msg.Attempts != 3 {
+		t.Errorf("unexpected attempts: real %v, expected %v", msg.Attempts, 3)
+	}
+	stored, err := store.List()
+	if err != nil || len(stored) != 1 || stored[0].Status != StatusSent {
+		t.Errorf("unexpected stored messages: %v, %#v", err, stored)
+	}
+}
+
+func TestQueue_ResumeAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "email_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the previous process crashed during a Save
+	leftover := dir + "/0000000000000000001-00000000.123.tmp"
+	if err := ioutil.WriteFile(leftover, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := NewDirStore(dir)
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("expected leftover temporary file removed, got %v", err)
+	}
+	// the previous process crashed while sending
+	crashed := QueuedMessage{ID: "0000000000000000001-00000000",
+		TargetEmail: "target@example.com", Status: StatusSending}
+	if err := store.Save(crashed); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan string, 1)
+	q, err := NewQueue(sendMailFunc(func(target string, _ string, _ MIMEType, _ string) error {
+		sent <- target
+		return nil
+	}), store, QueueConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := q.Status(crashed.ID); msg.Status != StatusQueued {
+		t.Errorf("unexpected status after restart: %v", msg.Status)
+	}
+	q.Start()
+	defer q.Stop()
+	if target := <-sent; target != crashed.TargetEmail {
+		t.Errorf("unexpected target: %v", target)
+	}
+	waitForStatus(t, q, crashed.ID, StatusSent)
+}
+
+func TestQueue_FailedAndDeadLettered(t *testing.T) {
+	q, err := NewQueue(sendMailFunc(func(target string, _ string, _ MIMEType, _ string) error {
+		if target == "rejected@example.com" {
+			return &SendError{Stage: StageEnvelope,
+				Err: &textproto.Error{Code: 550, Msg: "no such user"}}
+		}
+		return &SendError{Stage: StageDataEnd,
+			Err: errors.New("connection reset"), MaybeDelivered: true}
+	}), NewMemoryStore(), QueueConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	defer q.Stop()
+	id0, _ := q.Enqueue("rejected@example.com", "subject0", TextPlain, "content0")
+	id1, _ := q.Enqueue("maybe@example.com", "subject1", TextPlain, "content1")
+	waitForStatus(t, q, id0, StatusFailed)
+	msg1 := waitForStatus(t, q, id1, StatusDeadLettered)
+	if msg1.Attempts != 1 {
+		t.Errorf("maybe delivered message was resent: %v attempts", msg1.Attempts)
+	}
+	if n := len(q.List(StatusDeadLettered)); n != 1 {
+		t.Errorf("unexpected dead letters: %v", n)
+	}
+	if err := q.Remove(id0); err != nil {
+		t.Error(err)
+	}
+	if _, err := q.Status(id0); err != ErrMessageNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestQueue_WakeAllWorkers(t *testing.T) {
+	// each send blocks until all workers are sending at the same time
+	const workers = 3
+	arrived, release := make(chan struct{}, workers), make(chan struct{})
+	sender := sendMailFunc(func(string, string, MIMEType, string) error {
+		arrived <- struct{}{}
+		<-release
+		return nil
+	})
+	q, err := NewQueue(sender, NewMemoryStore(), QueueConfig{Workers: workers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	time.Sleep(20 * time.Millisecond) // let the workers become idle
+	for i := 0; i < workers; i++ {
+		if _, err := q.Enqueue("target@example.com", "s", TextPlain, "c"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < workers; i++ {
+		select {
+		case <-arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %v of %v idle workers woke up", i, workers)
+		}
+	}
+	close(release)
+	q.Stop()
+	q.Stop() // must not panic
+}
+
+func TestQueue_KeepSentAndRestart(t *testing.T) {
+	store := NewMemoryStore()
+	q, err := NewQueue(sendMailFunc(func(string, string, MIMEType, string) error {
+		return nil
+	}), store, QueueConfig{KeepSent: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	q.Stop()
+	q.Start() // a stopped queue can be started again
+	defer q.Stop()
+	id, err := q.Enqueue("target@example.com", "s", TextPlain, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, q, id, StatusSent)
+	for i := 0; i < 200; i++ {
+		if _, err := q.Status(id); err == ErrMessageNotFound {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+		q.mutex.Lock()
+		q.notify() // the workers check expired messages when they wake up
+		q.mutex.Unlock()
+	}
+	if _, err := q.Status(id); err != ErrMessageNotFound {
+		t.Errorf("expected sent message removed after KeepSent, got %v", err)
+	}
+	stored, _ := store.List()
+	for _, msg := range stored {
+		if msg.ID == id {
+			t.Errorf("expected sent message removed from the store")
+		}
+	}
+}
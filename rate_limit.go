@@ -0,0 +1,187 @@
+package email
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SendLimit is how many emails an account can send,
+// a zero field means unlimited, a Sender for a server in Profiles uses
+// ProviderProfile.SendLimit by default, the providers do not publish exact
+// numbers so the defaults are conservative
+type SendLimit struct {
+	PerMinute int // in any rolling minute
+	PerDay    int // in any rolling 24 hours
+}
+
+// LimitPolicy decides what SendMail does when the limit is reached
+type LimitPolicy string
+
+// LimitPolicy enum
+const (
+	// LimitFailFast returns a RateLimitError immediately, a Queue over the
+	// Sender keeps such a message queued until RateLimitError.RetryAt
+	// without counting a failed attempt
+	LimitFailFast LimitPolicy = "failFast"
+	// LimitBlock waits until the limit allows sending,
+	// can be hours if the daily quota is used up
+	LimitBlock LimitPolicy = "block"
+)
+
+// WithSendLimit overrides ProviderProfile.SendLimit,
+// SendLimit{} disables rate limiting
+func WithSendLimit(limit SendLimit) SenderOption {
+	return func(s *Sender) {
+		s.limiter = newRateLimiter(limit)
+	}
+}
+
+// WithLimitPolicy sets the behavior when the limit is reached,
+// default is LimitFailFast
+func WithLimitPolicy(policy LimitPolicy) SenderOption {
+	return func(s *Sender) { s.limitPolicy = policy }
+}
+
+// RateLimitError is returned by SendMail if the Sender's limit is reached,
+// the email was not sent
+type RateLimitError struct {
+	Window  string    // "minute" or "day"
+	RetryAt time.Time // the earliest time a slot will be available
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("send limit per %v reached, retry at %v",
+		e.Window, e.RetryAt.Format(time.RFC3339))
+}
+
+// Quota is the remaining number of emails a Sender can send now,
+// -1 means unlimited
+type Quota struct {
+	RemainingMinute int
+	RemainingDay    int
+	// ResetAt is when the oldest counted email leaves the day window,
+	// zero if nothing was counted
+	ResetAt time.Time
+}
+
+// RemainingQuota returns the remaining sends allowed by the Sender's limit,
+// only emails sent through this Sender are counted
+func (m Sender) RemainingQuota() Quota {
+	if m.limiter == nil {
+		return Quota{RemainingMinute: -1, RemainingDay: -1}
+	}
+	return m.limiter.remaining()
+}
+
+// acquireSendSlot counts an email against the limit before sending,
+// the returned release func should be called if the email was not sent
+func (m Sender) acquireSendSlot() (release func(), err error) {
+	if m.limiter == nil {
+		return func() {}, nil
+	}
+	for {
+		slot, rateErr := m.limiter.reserve()
+		if rateErr == nil {
+			return func() { m.limiter.cancel(slot) }, nil
+		}
+		if m.limitPolicy != LimitBlock {
+			return nil, rateErr
+		}
+		time.Sleep(time.Until(rateErr.RetryAt))
+	}
+}
+
+// rateLimiter counts sends in a rolling day window
+type rateLimiter struct {
+	limit SendLimit
+	now   func() time.Time // can be replaced in tests
+
+	mutex *sync.Mutex // protect sends
+	sends []time.Time // sorted, within the last 24 hours
+}
+
+func newRateLimiter(limit SendLimit) *rateLimiter {
+	if limit.PerMinute <= 0 && limit.PerDay <= 0 {
+		return nil
+	}
+	return &rateLimiter{limit: limit, now: time.Now, mutex: &sync.Mutex{}}
+}
+
+// prune must be called while holding the mutex
+func (l *rateLimiter) prune(now time.Time) {
+	i := 0
+	for i < len(l.sends) && !l.sends[i].After(now.Add(-24*time.Hour)) {
+		i++
+	}
+	l.sends = l.sends[i:]
+}
+
+// countSince must be called while holding the mutex
+func (l *rateLimiter) countSince(since time.Time) int {
+	count := 0
+	for i := len(l.sends) - 1; i >= 0 && l.sends[i].After(since); i-- {
+		count++
+	}
+	return count
+}
+
+// reserve returns the counted send time or an error if the limit is reached
+func (l *rateLimiter) reserve() (time.Time, *RateLimitError) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.prune(now)
+	if l.limit.PerDay > 0 && len(l.sends) >= l.limit.PerDay {
+		oldest := l.sends[len(l.sends)-l.limit.PerDay]
+		return time.Time{}, &RateLimitError{
+			Window: "day", RetryAt: oldest.Add(24 * time.Hour)}
+	}
+	if l.limit.PerMinute > 0 &&
+		l.countSince(now.Add(-time.Minute)) >= l.limit.PerMinute {
+		oldest := l.sends[len(l.sends)-l.limit.PerMinute]
+		return time.Time{}, &RateLimitError{
+			Window: "minute", RetryAt: oldest.Add(time.Minute)}
+	}
+	l.sends = append(l.sends, now)
+	return now, nil
+}
+
+// cancel uncounts a reserved send
+func (l *rateLimiter) cancel(slot time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i := len(l.sends) - 1; i >= 0; i-- {
+		if l.sends[i].Equal(slot) {
+			l.sends = append(l.sends[:i], l.sends[i+1:]...)
+			return
+		}
+	}
+}
+
+func (l *rateLimiter) remaining() Quota {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.prune(now)
+	ret := Quota{RemainingMinute: -1, RemainingDay: -1}
+	if l.limit.PerMinute > 0 {
+		ret.RemainingMinute = l.limit.PerMinute - l.countSince(now.Add(-time.Minute))
+		if ret.RemainingMinute < 0 {
+			ret.RemainingMinute = 0
+		}
+	}
+	if l.limit.PerDay > 0 {
+		ret.RemainingDay = l.limit.PerDay - len(l.sends)
+		if ret.RemainingDay < 0 {
+			ret.RemainingDay = 0
+		}
+		if ret.RemainingMinute > ret.RemainingDay {
+			ret.RemainingMinute = ret.RemainingDay
+		}
+	}
+	if len(l.sends) > 0 {
+		ret.ResetAt = l.sends[0].Add(24 * time.Hour)
+	}
+	return ret
+}
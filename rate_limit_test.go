@@ -0,0 +1,107 @@
+package email
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2021-06-01T00:00:00Z")
+	l := newRateLimiter(SendLimit{PerMinute: 2, PerDay: 3})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.reserve(); err != nil {
+			t.Fatalf("reserve %v: %v", i, err)
+		}
+		now = now.Add(time.Second)
+	}
+	_, err := l.reserve()
+	if err == nil || err.Window != "minute" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := now.Add(-2*time.Second + time.Minute); !err.RetryAt.Equal(expected) {
+		t.Errorf("unexpected RetryAt: real %v, expected %v", err.RetryAt, expected)
+	}
+	if q := l.remaining(); q.RemainingMinute != 0 || q.RemainingDay != 1 {
+		t.Errorf("unexpected quota: %#v", q)
+	}
+
+	now = now.Add(time.Minute)
+	slot, err := l.reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.reserve(); err == nil || err.Window != "day" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.cancel(slot) // the email was not sent
+	if q := l.remaining(); q.RemainingDay != 1 {
+		t.Errorf("unexpected quota after cancel: %#v", q)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if q := l.remaining(); q.RemainingMinute != 2 || q.RemainingDay != 3 {
+		t.Errorf("unexpected quota next day: %#v", q)
+	}
+}
+
+func TestSender_RateLimitFailFast(t *testing.T) {
+	server := newFakeSMTPServer(t, nil)
+	sender := server.sender()
+	WithSendLimit(SendLimit{PerMinute: 1})(&sender)
+	if err := sender.SendMail("target@example.com", "s0", TextPlain, "c0"); err != nil {
+		t.Fatal(err)
+	}
+	err := sender.SendMail("target@example.com", "s1", TextPlain, "c1")
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(server.receivedMessages()); n != 1 {
+		t.Errorf("unexpected received: real %v, expected %v", n, 1)
+	}
+	if q := sender.RemainingQuota(); q.RemainingMinute != 0 || q.RemainingDay != -1 {
+		t.Errorf("unexpected quota: %#v", q)
+	}
+}
+
+func TestSender_RateLimitReleaseOnFailure(t *testing.T) {
+	server := newFakeSMTPServer(t, func(session int, cmd string) string {
+		if session == 1 && cmd == "RCPT" {
+			return "550 no such user"
+		}
+		return ""
+	})
+	sender := server.sender()
+	WithSendLimit(SendLimit{PerDay: 1})(&sender)
+	if err := sender.SendMail("target@example.com", "s0", TextPlain, "c0"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := sender.SendMail("target@example.com", "s1", TextPlain, "c1"); err != nil {
+		t.Errorf("rejected email should not use the quota: %v", err)
+	}
+}
+
+func TestQueue_RateLimited(t *testing.T) {
+	calls := make(chan bool, 2)
+	q, err := NewQueue(sendMailFunc(func(string, string, MIMEType, string) error {
+		calls <- true
+		if len(calls) == 1 {
+			return &RateLimitError{Window: "minute",
+				RetryAt: time.Now().Add(20 * time.Millisecond)}
+		}
+		return nil
+	}), NewMemoryStore(), QueueConfig{Retry: RetryPolicy{MaxAttempts: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	defer q.Stop()
+	id, _ := q.Enqueue("target@example.com", "subject0", TextPlain, "content0")
+	msg := waitForStatus(t, q, id, StatusSent)
+	if msg.Attempts != 1 {
+		t.Errorf("unexpected attempts: real %v, expected %v", msg.Attempts, 1)
+	}
+}
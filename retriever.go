@@ -5,19 +5,25 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"net"
 	"net/textproto"
 	"regexp"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
 	imap "github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
-	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/charset"
 )
 
+func init() {
+	// decode encoded-word subjects and display names in envelopes,
+	// importing charset also makes go-message decode non UTF-8 bodies
+	imap.CharsetReader = charset.Reader
+}
+
 // Sender wrapped an IMAP client
 type Retriever struct {
 	providerAddrIMAP string
@@ -31,6 +37,35 @@ type Retriever struct {
 	// must be read only after inited because of simple lock
 	boxClients map[MailBox]*client.Client
 	mutex      *sync.Mutex // protect above 2 maps
+	// go-imap clients are not goroutine safe, a command (or a Select then
+	// commands) on a box connection must hold the box lock
+	boxLocks map[MailBox]*sync.Mutex
+
+	tlsConfig    *tls.Config   // nil means verify the server certificate
+	pollInterval time.Duration // how often to check for new messages
+	// strictParsing makes retrieving fail on a malformed message
+	strictParsing bool
+}
+
+// RetrieverOption customizes a Retriever in NewRetriever
+type RetrieverOption func(*Retriever)
+
+// WithRetrieverTLSConfig sets the TLS config for connecting to the server,
+// example: &tls.Config{InsecureSkipVerify: true}
+func WithRetrieverTLSConfig(config *tls.Config) RetrieverOption {
+	return func(r *Retriever) { r.tlsConfig = config }
+}
+
+// WithStrictParsing makes RetrieveMails return an error if a message is
+// malformed, by default the message is returned with Message.ParseErr
+func WithStrictParsing() RetrieverOption {
+	return func(r *Retriever) { r.strictParsing = true }
+}
+
+// WithPollInterval sets how often RetrieveNewMail checks for new messages,
+// default is 10 seconds
+func WithPollInterval(interval time.Duration) RetrieverOption {
+	return func(r *Retriever) { r.pollInterval = interval }
 }
 
 // MailBox is a mail box regex to match provider mail box name,
@@ -51,10 +86,11 @@ func (p MailBox) CheckMatch(mailBoxName string) bool {
 }
 
 // NewSender connects to IMAP server then selects mail boxes,
-// :arg providerAddrIMAP: example: "imap.gmail.com:993", see `popular_providers.go` for more examples,
+// port 143 uses STARTTLS, other ports use implicit TLS,
+// :arg providerAddrIMAP: example: "imap.gmail.com:993", see Profiles for more examples,
 // :arg username: string, example: "daominahpublic@gmail.com"
-func NewRetriever(providerAddrIMAP string, username string, password string) (
-	*Retriever, error) {
+func NewRetriever(providerAddrIMAP string, username string, password string,
+	options ...RetrieverOption) (*Retriever, error) {
 	ret := &Retriever{
 		providerAddrIMAP: providerAddrIMAP,
 		username:         username,
@@ -62,17 +98,20 @@ func NewRetriever(providerAddrIMAP string, username string, password string) (
 		boxNames:         make(map[MailBox]string),
 		boxClients:       make(map[MailBox]*client.Client),
 		mutex:            &sync.Mutex{},
+		boxLocks:         map[MailBox]*sync.Mutex{Inbox: {}, Spam: {}},
+		pollInterval:     10 * time.Second,
+	}
+	for _, option := range options {
+		option(ret)
 	}
 	boxesToFetch := []MailBox{Inbox, Spam}
 	errsChan := make(chan error, len(boxesToFetch))
 	for _, mailBoxPtn := range boxesToFetch {
 		mailBoxPtn := mailBoxPtn
 		go func() {
-			var tlsConfig *tls.Config = nil
-			//var tlsConfig = &tls.Config{InsecureSkipVerify: true}
-			client0, err := client.DialTLS(providerAddrIMAP, tlsConfig)
+			client0, err := ret.dial()
 			if err != nil {
-				errsChan <- fmt.Errorf("client DialTLS: %v", err)
+				errsChan <- err
 				return
 			}
 			if err := client0.Login(username, password); err != nil {
@@ -93,6 +132,8 @@ func NewRetriever(providerAddrIMAP string, username string, password string) (
 					break
 				}
 			}
+			// read-only so reading does not change the box (such as
+			// clearing \Recent), see selectWritable
 			mailBoxStatus, err := client0.Select(mailBoxName, true)
 			if err != nil {
 				errsChan <- fmt.Errorf("select mail box %v: %v", mailBoxName, err)
@@ -116,6 +157,43 @@ func NewRetriever(providerAddrIMAP string, username string, password string) (
 	return ret, nil
 }
 
+// dial connects with implicit TLS or, on port 143, upgrades a plain
+// connection with STARTTLS, a server without STARTTLS is refused because
+// the password would be sent in clear text
+func (r *Retriever) dial() (*client.Client, error) {
+	host, port, err := net.SplitHostPort(r.providerAddrIMAP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address: %v", err)
+	}
+	if port != "143" {
+		cli, err := client.DialTLS(r.providerAddrIMAP, r.tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("client DialTLS: %v", err)
+		}
+		return cli, nil
+	}
+	cli, err := client.Dial(r.providerAddrIMAP)
+	if err != nil {
+		return nil, fmt.Errorf("client Dial: %v", err)
+	}
+	if ok, err := cli.SupportStartTLS(); err != nil || !ok {
+		cli.Logout()
+		if err == nil {
+			err = errors.New("not supported")
+		}
+		return nil, fmt.Errorf("client StartTLS: %v", err)
+	}
+	tlsConfig := r.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+	if err := cli.StartTLS(tlsConfig); err != nil {
+		cli.Logout()
+		return nil, fmt.Errorf("client StartTLS: %v", err)
+	}
+	return cli, nil
+}
+
 // CloseConnections tries to gracefully closes the connections
 func (r Retriever) CloseConnections() {
 	for _, cli := range r.boxClients {
@@ -125,180 +203,406 @@ func (r Retriever) CloseConnections() {
 
 // SearchCriteria simplifies IMAP's search criteria format
 type SearchCriteria struct {
-	SentSince  time.Time // header Date is later than the filter, regarding time
-	SentBefore time.Time // header Date is earlier than the filter, disregarding time
+	SentSince  time.Time // header Date is on or after the filter, regarding time
+	SentBefore time.Time // header Date is earlier than the filter, regarding time
 	From       string    // sender address matches exactly the specified string
 	Subject    string    // header Subject contains the specified string
 	Text       string    // header or body (space split) contains the specified string
+
+	WithFlags    []string // has all the flags, such as FlagFlagged
+	WithoutFlags []string // has none of the flags, []string{FlagSeen} means unseen only
+
+	To     string               // header To contains the specified string
+	Cc     string               // header Cc contains the specified string
+	Bcc    string               // header Bcc contains the specified string
+	Header textproto.MIMEHeader // each header contains the values, "" means the header exists
+	Body   string               // body contains the specified string
+
+	Since   time.Time // internal date (server receiving time) is on or after the date
+	Before  time.Time // internal date is earlier than the date, disregarding time
+	Larger  uint32    // size in bytes is larger than the number
+	Smaller uint32    // size in bytes is smaller than the number
+	UIDs    string    // UID set, example: "1:100,205" or "300:*"
+
+	// the message matches all above fields and also the Not and Or criteria:
+
+	Not []SearchCriteria    // does not match any of the criteria
+	Or  [][2]SearchCriteria // matches at least 1 criteria of each pair
+
+	// ByInternalDate makes SentSince and SentBefore compare the internal
+	// date instead of header Date, that is set by the sender and can be
+	// spoofed or skewed
+	ByInternalDate bool
 }
 
-// Message simplifies IMAP's email format
+// imapCriteria translates the filter so IMAP server does the search,
+// IMAP disregards the time of day of dates and SENTSINCE, SENTBEFORE
+// compare the date in the zone of the header Date (-12:00 to +14:00),
+// so if widen, SentSince and SentBefore are widened by widenDates and
+// matchTime must be checked on the client, Not and Or criteria are not
+// widened so they have day precision
+func (c SearchCriteria) imapCriteria(widen bool) (*imap.SearchCriteria, error) {
+	search := &imap.SearchCriteria{
+		Since: c.Since, Before: c.Before,
+		WithFlags: c.WithFlags, WithoutFlags: c.WithoutFlags,
+		Larger: c.Larger, Smaller: c.Smaller,
+	}
+	searchHeader := textproto.MIMEHeader{}
+	for key, values := range c.Header {
+		for _, value := range values {
+			searchHeader.Add(key, value)
+		}
+	}
+	for _, header := range []struct{ key, value string }{
+		{"From", c.From}, {"Subject", c.Subject},
+		{"To", c.To}, {"Cc", c.Cc}, {"Bcc", c.Bcc},
+	} {
+		if header.value != "" {
+			searchHeader.Add(header.key, header.value)
+		}
+	}
+	if len(searchHeader) != 0 {
+		search.Header = searchHeader
+	}
+	since, before := c.SentSince, c.SentBefore
+	if widen && !since.IsZero() {
+		since = since.Add(-widenDates)
+	}
+	if widen && !before.IsZero() {
+		before = before.Add(widenDates)
+	}
+	if !c.ByInternalDate {
+		search.SentSince, search.SentBefore = since, before
+	} else {
+		if since.After(search.Since) {
+			search.Since = since
+		}
+		if !before.IsZero() && (search.Before.IsZero() || before.Before(search.Before)) {
+			search.Before = before
+		}
+	}
+	if c.Text != "" {
+		search.Text = []string{c.Text}
+	}
+	if c.Body != "" {
+		search.Body = []string{c.Body}
+	}
+	if c.UIDs != "" {
+		uids, err := imap.ParseSeqSet(c.UIDs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UIDs %q: %v", c.UIDs, err)
+		}
+		search.Uid = uids
+	}
+	for _, not := range c.Not {
+		notSearch, err := not.imapCriteria(false)
+		if err != nil {
+			return nil, err
+		}
+		search.Not = append(search.Not, notSearch)
+	}
+	for _, or := range c.Or {
+		left, err := or[0].imapCriteria(false)
+		if err != nil {
+			return nil, err
+		}
+		right, err := or[1].imapCriteria(false)
+		if err != nil {
+			return nil, err
+		}
+		search.Or = append(search.Or, [2]*imap.SearchCriteria{left, right})
+	}
+	return search, nil
+}
+
+// widenDates covers the day precision of IMAP dates plus the offset of
+// the header Date zone from the bound zone (up to 26 hours)
+const widenDates = 72 * time.Hour
+
+// matchTime checks SentSince and SentBefore with time precision
+func (c SearchCriteria) matchTime(msg Message) bool {
+	t := msg.Date
+	if c.ByInternalDate {
+		t = msg.InternalDate
+	}
+	if !c.SentSince.IsZero() && t.Before(c.SentSince) {
+		return false
+	}
+	if !c.SentBefore.IsZero() && !t.Before(c.SentBefore) {
+		return false
+	}
+	return true
+}
+
+// Message simplifies IMAP's email format,
+// it is not comparable with == since it has Flags and Header, use
+// MailBox and UID to identify a retrieved message
 type Message struct {
-	Date    time.Time // Envelope.Date
-	From    string    // Envelope.From[0].Address
-	Subject string    // Envelope.Subject
-	Body    string    // only support TextPlain or TextHTML
+	Date     time.Time // Envelope.Date, header Date set by the sender
+	From     string    // Envelope.From[0].Address
+	FromName string    // Envelope.From[0].PersonalName, example: "Nguyễn Văn A"
+	Subject  string    // Envelope.Subject
+	Body     string    // only support TextPlain or TextHTML
+	UID      uint32    // unique in the MailBox, used by flag operations
+	Flags    []string  // when retrieved, such as FlagSeen and custom keywords
+
+	InternalDate time.Time // when the server received the message
 
 	// following fields are not important, can be ignore
 
 	MIMEType         MIMEType // BodyStructure.MIMEType/BodyStructure.MIMESubType
 	MainPartMIMEType MIMEType // only support TextPlain or TextHTML
 	MailBox          MailBox  // only support INBOX and SPAM
+	// Charset is the declared charset of the main part, example: "iso-2022-jp",
+	// FromName, Subject and Body are always decoded to UTF-8
+	Charset string
+	// ParseErr is not nil if the message is malformed, Body can be partial
+	ParseErr error
+
+	// Header has the raw fields (encoded words are not decoded),
+	// it is nil in FetchEnvelope mode
+	Header    textproto.MIMEHeader
+	Size      uint32 // RFC822.SIZE of the whole message in bytes
+	Truncated bool   // Body is partial because of WithMaxBytes
+
+	raw []byte // see Raw
 }
 
-// retrieveMails simplifies IMAP's fetch
-func (r Retriever) retrieveMails(filter SearchCriteria, boxName MailBox) (
-	[]Message, error) {
-	boxClient := r.boxClients[boxName]
+// selectedClient returns the connection that selected the box, locked
+// until the caller calls unlock
+func (r Retriever) selectedClient(boxName MailBox) (*client.Client, func(), error) {
+	r.mutex.Lock()
+	boxClient, lock := r.boxClients[boxName], r.boxLocks[boxName]
+	r.mutex.Unlock()
 	if boxClient == nil {
-		return nil, fmt.Errorf("invalid mail box name %v", boxName)
+		return nil, nil, fmt.Errorf("invalid mail box name %v", boxName)
+	}
+	lock.Lock()
+	return boxClient, lock.Unlock, nil
+}
+
+// selectWritable selects the box read-write before a command that changes
+// messages (STORE, MOVE, EXPUNGE), the box stays read-write until the next
+// retrieving selects it read-only, the box lock must be held
+func (r Retriever) selectWritable(boxClient *client.Client, box MailBox) error {
+	if _, err := boxClient.Select(r.mailboxName(box), false); err != nil {
+		return fmt.Errorf("select mail box: %v", err)
+	}
+	return nil
+}
+
+// maxFetchedMessages is the most messages fetched from a box at once,
+// the last ones are kept
+const maxFetchedMessages = 1000
+
+// retrieveMails simplifies IMAP's fetch
+func (r Retriever) retrieveMails(filter SearchCriteria, boxName MailBox,
+	config fetchConfig) ([]Message, error) {
+	boxClient, unlock, err := r.selectedClient(boxName)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 	// feels like we need to reselect the mail box to get new message
-	_, err := boxClient.Select(r.boxNames[boxName], true)
+	_, err = boxClient.Select(r.boxNames[boxName], true)
 	if err != nil {
 		return nil, fmt.Errorf("select mail box: %v", err)
 	}
 
-	search := &imap.SearchCriteria{}
-	if !filter.SentSince.IsZero() {
-		// IMAP's search specs disregards time so this filter should be excess,
-		// we will filter by time for each message later
-		search.SentSince = filter.SentSince.Add(-24 * time.Hour)
-	}
-	if !filter.SentBefore.IsZero() {
-		search.SentBefore = filter.SentBefore
-	}
-	searchHeader := textproto.MIMEHeader{}
-	if filter.From != "" {
-		searchHeader.Set("From", filter.From)
-	}
-	if filter.Subject != "" {
-		searchHeader.Set("Subject", filter.Subject)
-	}
-	if len(searchHeader) != 0 {
-		search.Header = searchHeader
-	}
-	if filter.Text != "" {
-		search.Text = []string{filter.Text}
+	search, err := filter.imapCriteria(true)
+	if err != nil {
+		return nil, err
 	}
 
-	seqNums, err := boxClient.Search(search)
+	uids, err := boxClient.UidSearch(search)
 	if err != nil {
 		return nil, fmt.Errorf("imap search request failed: %v", err)
 	}
-	if len(seqNums) == 0 {
+	if len(uids) == 0 {
 		return nil, nil
 	}
-	if len(seqNums) > 1000 { // just for safe, input query should limit date range
-		seqNums = seqNums[len(seqNums)-1000:]
+	if len(uids) > maxFetchedMessages { // input query should limit date range
+		uids = uids[len(uids)-maxFetchedMessages:]
 	}
 	seqSet := new(imap.SeqSet)
-	seqSet.AddNum(seqNums...)
+	seqSet.AddNum(uids...)
 
-	bodySection := &imap.BodySectionName{} // const
-	fetchItems := []imap.FetchItem{imap.FetchEnvelope, imap.FetchBody, bodySection.FetchItem()}
-	imapMessages := make(chan *imap.Message, len(seqNums))
-	err = boxClient.Fetch(seqSet, fetchItems, imapMessages)
+	bodySection := config.section() // const
+	fetchItems := []imap.FetchItem{imap.FetchEnvelope, imap.FetchBodyStructure,
+		imap.FetchUid, imap.FetchFlags, imap.FetchInternalDate, imap.FetchRFC822Size}
+	if bodySection != nil {
+		fetchItems = append(fetchItems, bodySection.FetchItem())
+	}
+	imapMessages := make(chan *imap.Message, len(uids))
+	err = boxClient.UidFetch(seqSet, fetchItems, imapMessages)
 	if err != nil {
 		return nil, fmt.Errorf("imap fetch request failed: %v", err)
 	}
 	ret := make([]Message, 0)
+	// FetchText downloads the text parts after knowing the structures
+	structures := make(map[uint32]*imap.BodyStructure)
 	for imapMsg := range imapMessages {
-		msg := Message{MailBox: boxName}
-
-		if imapMsg.Envelope != nil {
-			msg.Date = imapMsg.Envelope.Date
-			if msg.Date.Before(filter.SentSince) {
-				continue
-			}
-			if len(imapMsg.Envelope.From) > 0 {
-				msg.From = imapMsg.Envelope.From[0].Address()
-			}
-			msg.Subject = imapMsg.Envelope.Subject
+		msg := messageFromIMAP(boxName, imapMsg)
+		if !filter.matchTime(msg) {
+			continue
 		}
 		if imapMsg.BodyStructure != nil {
 			msg.MIMEType = MIMEType(fmt.Sprintf("%v/%v",
 				imapMsg.BodyStructure.MIMEType, imapMsg.BodyStructure.MIMESubType))
 		}
 
-		bodyReader := imapMsg.GetBody(bodySection)
-		if bodyReader == nil {
-			return nil, fmt.Errorf("imap body section not found")
-		}
-		mailReader, err := mail.CreateReader(bodyReader)
-		if err != nil {
-			return nil, fmt.Errorf("mail CreateReader: %v", err)
-		}
-		_ = mailReader
-		for { // loop through all parts but only care about text part
-			part, err := mailReader.NextPart()
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return nil, fmt.Errorf("mailReader NextPart: %v", err)
-			}
-			switch header := part.Header.(type) {
-			case *mail.InlineHeader: // text/plain or text/html
-				if strings.Contains(part.Header.Get("Content-Type"), "text/plain") {
-					if msg.MainPartMIMEType == TextHTML && msg.Body != "" {
-						// skip fetch plain text that is similar to fetched html
-						continue
-					} else {
-						msg.MainPartMIMEType = TextPlain
-					}
-				} else {
-					msg.MainPartMIMEType = TextHTML
-				}
-				content, err := ioutil.ReadAll(part.Body)
+		if bodySection != nil {
+			msg.Truncated = config.mode == FetchFull &&
+				config.maxBytes > 0 && msg.Size > config.maxBytes
+			bodyReader := imapMsg.GetBody(bodySection)
+			switch {
+			case bodyReader == nil:
+				msg.ParseErr = fmt.Errorf("imap body section not found")
+			case config.mode == FetchFull:
+				data, err := ioutil.ReadAll(bodyReader)
 				if err != nil {
-					return nil, fmt.Errorf("ioutil ReadAll part: %v", err)
+					return nil, fmt.Errorf("read message: %v", err)
 				}
-				msg.Body = string(content)
-			case *mail.AttachmentHeader:
-				_, _ = header.Filename()
-				continue // ignore images, files, ..
+				if !msg.Truncated {
+					msg.raw = data
+				}
+				msg.ParseErr = parseBody(data, &msg)
+			default:
+				msg.ParseErr = parseHeader(bodyReader, &msg)
 			}
 		}
-
+		if config.mode == FetchText && msg.ParseErr == nil && imapMsg.BodyStructure != nil {
+			structures[msg.UID] = imapMsg.BodyStructure
+		}
 		ret = append(ret, msg)
 	}
+	if len(structures) > 0 {
+		config.fetchTextParts(boxClient, ret, structures)
+	}
+	for i, msg := range ret {
+		if msg.Truncated {
+			ret[i].ParseErr = nil // a partial message is expected to be malformed
+		} else if msg.ParseErr != nil && r.strictParsing {
+			return nil, msg.ParseErr
+		}
+	}
 	return ret, nil
 }
 
-// retrieveMails simplifies IMAP's fetch (from inbox and spam)
-func (r Retriever) RetrieveMails(filter SearchCriteria) ([]Message, error) {
-	retChan := make(chan []Message, len(r.boxClients))
-	errChan := make(chan error, len(r.boxClients))
-	for boxName, _ := range r.boxClients {
-		boxName := boxName
+// retrieveMails simplifies IMAP's fetch (from inbox and spam),
+// by default the whole messages are downloaded, see WithFetchMode
+func (r Retriever) RetrieveMails(filter SearchCriteria, options ...FetchOption) (
+	[]Message, error) {
+	return r.retrieveBoxes(filter, nil, newFetchConfig(options))
+}
+
+// messageFromIMAP returns a Message with the envelope fields, flags and size
+func messageFromIMAP(boxName MailBox, imapMsg *imap.Message) Message {
+	msg := Message{MailBox: boxName, UID: imapMsg.Uid, Flags: imapMsg.Flags,
+		InternalDate: imapMsg.InternalDate, Size: imapMsg.Size}
+	if imapMsg.Envelope != nil {
+		msg.Date = imapMsg.Envelope.Date
+		if len(imapMsg.Envelope.From) > 0 {
+			msg.From = imapMsg.Envelope.From[0].Address()
+			msg.FromName = imapMsg.Envelope.From[0].PersonalName
+		}
+		msg.Subject = imapMsg.Envelope.Subject
+	}
+	return msg
+}
+
+// retrieveBoxes returns messages of all boxes in order Inbox then Spam,
+// if minUIDs is not nil, only the boxes in it are searched and only
+// messages with UID >= minUIDs[box] are returned
+func (r Retriever) retrieveBoxes(filter SearchCriteria,
+	minUIDs map[MailBox]uint32, config fetchConfig) ([]Message, error) {
+	boxes := make([]MailBox, 0)
+	for _, boxName := range []MailBox{Inbox, Spam} {
+		if _, found := minUIDs[boxName]; minUIDs != nil && !found {
+			continue
+		}
+		if r.boxClients[boxName] != nil {
+			boxes = append(boxes, boxName)
+		}
+	}
+	results := make([][]Message, len(boxes))
+	errs := make([]error, len(boxes))
+	wg := &sync.WaitGroup{}
+	for i, boxName := range boxes {
+		i, boxName := i, boxName
+		wg.Add(1)
 		go func() {
-			msgs, err := r.retrieveMails(filter, boxName)
-			retChan <- msgs
-			errChan <- err
+			defer wg.Done()
+			boxFilter, minUID := filter, minUIDs[boxName]
+			if minUID > 0 && boxFilter.UIDs == "" {
+				boxFilter.UIDs = fmt.Sprintf("%v:*", minUID)
+			}
+			msgs, err := r.retrieveMails(boxFilter, boxName, config)
+			// "n:*" matches the last message even if its UID is less than n
+			for _, msg := range msgs {
+				if msg.UID >= minUID {
+					results[i] = append(results[i], msg)
+				}
+			}
+			errs[i] = err
 		}()
 	}
-	for i := 0; i < len(r.boxClients); i++ {
-		oneBoxErr := <-errChan
-		if oneBoxErr != nil {
-			return nil, oneBoxErr
+	wg.Wait()
+	ret := make([]Message, 0)
+	for i := range boxes {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
+		ret = append(ret, results[i]...)
 	}
-	ret := make([]Message, 0)
-	for i := 0; i < len(r.boxClients); i++ {
-		oneBoxMsgs := <-retChan
-		ret = append(ret, oneBoxMsgs...)
+	return ret, nil
+}
+
+// uidNexts returns the UIDNEXT of each box, messages that arrive later
+// have UIDs greater than or equal to it
+func (r Retriever) uidNexts() (map[MailBox]uint32, error) {
+	ret := make(map[MailBox]uint32)
+	for boxName := range r.boxClients {
+		boxClient, unlock, err := r.selectedClient(boxName)
+		if err != nil {
+			return nil, err
+		}
+		status, err := boxClient.Select(r.boxNames[boxName], true)
+		unlock()
+		if err != nil {
+			return nil, fmt.Errorf("select mail box: %v", err)
+		}
+		ret[boxName] = status.UidNext
 	}
 	return ret, nil
 }
 
+// sortByArrival sorts messages by InternalDate, messages that arrived at
+// the same time keep their order (Inbox first, then by UID)
+func sortByArrival(msgs []Message) {
+	sort.SliceStable(msgs, func(i int, j int) bool {
+		return msgs[i].InternalDate.Before(msgs[j].InternalDate)
+	})
+}
+
 // RetrieveNewMail periodically check inbox and spam until getting a new message
-// or the input context is cancelled
+// or the input context is cancelled, messages in the boxes before the call
+// are ignored, if many new messages match the filter, returns the last arrival
 func (r Retriever) RetrieveNewMail(
 	ctx context.Context, filter SearchCriteria) (Message, error) {
+	startUIDs, err := r.uidNexts()
+	if err != nil {
+		return Message{}, err
+	}
 	var lastErr error
 	for i := 0; true; i++ {
 		if i > 0 {
-			time.Sleep(10 * time.Second)
+			timer := time.NewTimer(r.pollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
 		}
 		select {
 		case <-ctx.Done():
@@ -309,7 +613,7 @@ func (r Retriever) RetrieveNewMail(
 		default:
 			// continue to check inbox
 		}
-		msgs, err := r.RetrieveMails(filter)
+		msgs, err := r.retrieveBoxes(filter, startUIDs, newFetchConfig(nil))
 		if err != nil {
 			lastErr = err
 			continue
@@ -317,11 +621,7 @@ func (r Retriever) RetrieveNewMail(
 		if len(msgs) == 0 {
 			continue
 		}
-
-		//for _, m := range msgs {
-		//	fmt.Printf("debug msg %v: %v\n", m.Date, m.Body)
-		//}
-
+		sortByArrival(msgs)
 		return msgs[len(msgs)-1], nil
 	}
 	return Message{}, errors.New("unreachable")
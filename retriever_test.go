@@ -36,6 +36,179 @@ func TestMailBox_CheckMatch(t *testing.T) {
 	}
 }
 
+func TestRetriever_RetrieveMailsCriteria(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	day := time.Date(2021, 6, 7, 10, 0, 0, 0, time.UTC)
+	for i, raw := range []string{
+		"From: alice@example.com\r\nTo: bob@example.com\r\nCc: carol@example.com\r\n" +
+			"Subject: report\r\nX-Priority: 1\r\n\r\nquarterly numbers",
+		"From: alice@example.com\r\nTo: dave@example.com\r\n" +
+			"Subject: lunch\r\n\r\npizza",
+		"From: eve@example.com\r\nTo: bob@example.com\r\n" +
+			"Subject: report\r\n\r\n" + strings.Repeat("long ", 100),
+	} {
+		s.addMessage(t, "INBOX", nil, day.Add(time.Duration(i)*24*time.Hour), raw)
+	}
+	r := s.retriever(t)
+
+	for i, c := range []struct {
+		filter   SearchCriteria
+		expected []uint32
+	}{
+		{SearchCriteria{To: "bob@"}, []uint32{7, 9}},
+		{SearchCriteria{Cc: "carol"}, []uint32{7}},
+		{SearchCriteria{Header: textproto.MIMEHeader{"X-Priority": {""}}}, []uint32{7}},
+		{SearchCriteria{Body: "pizza"}, []uint32{8}},
+		{SearchCriteria{Since: day.Add(-48 * time.Hour), Before: day.Add(48 * time.Hour)},
+			[]uint32{7, 8}},
+		{SearchCriteria{Before: day.Add(24 * time.Hour), UIDs: "7:*"}, []uint32{7}},
+		{SearchCriteria{Larger: 400}, []uint32{9}},
+		{SearchCriteria{Subject: "report", Smaller: 400}, []uint32{7}},
+		{SearchCriteria{UIDs: "8:9"}, []uint32{8, 9}},
+		{SearchCriteria{From: "alice", Not: []SearchCriteria{{Subject: "lunch"}}},
+			[]uint32{7}},
+		{SearchCriteria{Or: [][2]SearchCriteria{{{Body: "pizza"}, {From: "eve"}}}},
+			[]uint32{8, 9}},
+	} {
+		msgs, err := r.RetrieveMails(c.filter)
+		if err != nil {
+			t.Fatalf("case %v: %v", i, err)
+		}
+		uids := make([]uint32, 0)
+		for _, msg := range msgs {
+			uids = append(uids, msg.UID)
+		}
+		if fmt.Sprint(uids) != fmt.Sprint(c.expected) {
+			t.Errorf("case %v: real %v, expected %v", i, uids, c.expected)
+		}
+	}
+	if _, err := r.RetrieveMails(SearchCriteria{UIDs: "a:b"}); err == nil {
+		t.Errorf("expected error for invalid UIDs")
+	}
+}
+
+func TestRetriever_RetrieveMailsTimePrecision(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	received := time.Date(2021, 6, 7, 12, 0, 0, 0, time.UTC)
+	// header Date is skewed 2 hours earlier than the server receiving time
+	for _, date := range []string{"08:00", "10:00", "12:00"} {
+		s.addMessage(t, "INBOX", nil, received,
+			"Date: Mon, 07 Jun 2021 "+date+":00 +0000\r\nSubject: at "+date+"\r\n\r\nhi")
+		received = received.Add(2 * time.Hour)
+	}
+	r := s.retriever(t)
+
+	msgs, err := r.RetrieveMails(SearchCriteria{
+		SentSince:  time.Date(2021, 6, 7, 9, 0, 0, 0, time.UTC),
+		SentBefore: time.Date(2021, 6, 7, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Subject != "at 10:00" {
+		t.Fatalf("unexpected messages by header Date: %#v", msgs)
+	}
+	if !msgs[0].InternalDate.Equal(time.Date(2021, 6, 7, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected InternalDate: %v", msgs[0].InternalDate)
+	}
+
+	msgs, err = r.RetrieveMails(SearchCriteria{
+		SentSince:      time.Date(2021, 6, 7, 13, 0, 0, 0, time.UTC),
+		SentBefore:     time.Date(2021, 6, 7, 16, 0, 0, 0, time.UTC),
+		ByInternalDate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Subject != "at 10:00" {
+		t.Fatalf("unexpected messages by internal date: %#v", msgs)
+	}
+
+	// sent at 19:00 UTC from a far-east zone, the header date is the next day
+	s.addMessage(t, "INBOX", nil, received,
+		"Date: Tue, 08 Jun 2021 09:00:00 +1400\r\nSubject: far east\r\n\r\nhi")
+	msgs, err = r.RetrieveMails(SearchCriteria{
+		SentSince:  time.Date(2021, 6, 7, 18, 0, 0, 0, time.UTC),
+		SentBefore: time.Date(2021, 6, 7, 20, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Subject != "far east" {
+		t.Fatalf("unexpected messages with a far-east Date: %#v", msgs)
+	}
+}
+
+func TestRetriever_RetrieveNewMail(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	now := time.Now()
+	s.addMessage(t, "INBOX", nil, now.Add(-time.Minute), "Subject: code 0\r\n\r\nold")
+	r := s.retriever(t, WithPollInterval(20*time.Millisecond))
+
+	added := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		err := s.appendMessage("Spam", nil, now.Add(2*time.Second), "Subject: code 2\r\n\r\nnew")
+		if err == nil {
+			err = s.appendMessage("INBOX", nil, now.Add(time.Second), "Subject: code 1\r\n\r\nnew")
+		}
+		added <- err
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := r.RetrieveNewMail(ctx, SearchCriteria{Subject: "code"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "code 2" || msg.MailBox != Spam {
+		t.Errorf("unexpected new message: %#v", msg)
+	}
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := r.RetrieveNewMail(ctx, SearchCriteria{Subject: "code"}); err != context.DeadlineExceeded {
+		t.Errorf("expected no new message, got error %v", err)
+	}
+}
+
+func TestRetriever_DecodeCharsets(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	for _, raw := range []string{
+		"From: =?ISO-8859-1?Q?Ren=E9?= <rene@example.com>\r\n" +
+			"Subject: =?GB2312?B?xOO6ww==?=\r\n" +
+			"Content-Type: text/plain; charset=KOI8-R\r\n\r\n" +
+			"\xf0\xd2\xc9\xd7\xc5\xd4",
+		"From: jp@example.com\r\nSubject: jp\r\n" +
+			"Content-Type: text/html; charset=ISO-2022-JP\r\n\r\n" +
+			"\x1b$B$3$s$K$A$O\x1b(B",
+		"From: x@example.com\r\nSubject: unknown\r\n" +
+			"Content-Type: text/plain; charset=x-unknown\r\n\r\nraw",
+	} {
+		s.addMessage(t, "INBOX", nil, time.Now(), raw)
+	}
+	r := s.retriever(t)
+	msgs, err := r.RetrieveMails(SearchCriteria{UIDs: "7:*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("unexpected messages: %#v", msgs)
+	}
+	if msgs[0].FromName != "René" || msgs[0].Subject != "你好" ||
+		msgs[0].Body != "Привет" || msgs[0].Charset != "koi8-r" {
+		t.Errorf("unexpected KOI8-R message: %#v", msgs[0])
+	}
+	if msgs[1].Body != "こんにちは" || msgs[1].Charset != "iso-2022-jp" {
+		t.Errorf("unexpected ISO-2022-JP message: %#v", msgs[1])
+	}
+	if msgs[2].Body != "raw" || msgs[2].Charset != "x-unknown" {
+		t.Errorf("unexpected unknown charset message: %#v", msgs[2])
+	}
+}
+
 func TestReceiver(t *testing.T) {
 	beginT := time.Now()
 	provider0, username0, password0 := GMail, "daominahpublic@gmail.com", "HayQuen0*"
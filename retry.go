@@ -0,0 +1,79 @@
+package email
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures how Sender retries temporary SMTP failures,
+// see SendError.Temporary for what is considered temporary
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts include the first one, <= 1 means no retry
+	InitialBackoff time.Duration // wait before the second attempt
+	MaxBackoff     time.Duration // upper bound of a wait, 0 means unlimited
+	Multiplier     float64       // a wait grows by this factor each attempt, < 1 means 2
+	Jitter         float64       // randomize each wait in [wait*(1-Jitter), wait*(1+Jitter)]
+	AttemptTimeout time.Duration // limit a whole SMTP dialogue, 0 means unlimited
+}
+
+// NoRetry is the policy of a Sender created without WithRetryPolicy
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// DefaultRetryPolicy waits long enough for most greylisting servers
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 15 * time.Second,
+	MaxBackoff:     5 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+	AttemptTimeout: 60 * time.Second,
+}
+
+// backoff returns the wait before the attempt number (attempt >= 1) + 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		wait *= multiplier
+		if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		wait = wait * (1 - p.Jitter + 2*p.Jitter*rand.Float64())
+	}
+	return time.Duration(wait)
+}
+
+// sendWithRetry calls sendSMTP until success, a non-temporary error or
+// running out of attempts, returns the last error
+func (m Sender) sendWithRetry(msg smtpMessage) error {
+	policy := m.retry
+	var lastErr error
+	for attempt := 1; true; attempt++ {
+		var deadline time.Time
+		if policy.AttemptTimeout > 0 {
+			deadline = time.Now().Add(policy.AttemptTimeout)
+		}
+		lastErr = m.sendSMTP(msg, deadline)
+		if lastErr == nil {
+			return nil
+		}
+		var sendErr *SendError
+		if !errors.As(lastErr, &sendErr) || !sendErr.Temporary() {
+			return lastErr
+		}
+		if attempt >= policy.MaxAttempts {
+			return lastErr
+		}
+		time.Sleep(policy.backoff(attempt))
+	}
+	return lastErr
+}
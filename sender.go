@@ -1,6 +1,8 @@
 package email
 
 import (
+	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"strconv"
@@ -15,51 +17,123 @@ type Sender struct {
 	providerAddrSMTP string
 	username         string
 	password         string
-	mailer           *gomail.Dialer
+	host             string
+	port             int
+	tlsConfig        *tls.Config // nil means verify the server certificate for host
+	retry            RetryPolicy
+	limiter          *rateLimiter // nil means unlimited
+	limitPolicy      LimitPolicy
+	sentCopy         *Retriever // nil means do not copy to the Sent mailbox
+	transport        transport  // nil means SMTP
+}
+
+// SenderOption customizes a Sender in NewSender
+type SenderOption func(*Sender)
+
+// WithRetryPolicy makes the Sender retry temporary SMTP failures,
+// default is NoRetry
+func WithRetryPolicy(policy RetryPolicy) SenderOption {
+	return func(s *Sender) { s.retry = policy }
+}
+
+// WithTLSConfig sets the TLS config for implicit TLS and STARTTLS,
+// example: &tls.Config{InsecureSkipVerify: true}
+func WithTLSConfig(config *tls.Config) SenderOption {
+	return func(s *Sender) { s.tlsConfig = config }
 }
 
 // NewSender connects and sends a test email to SMTP server,
-// :arg providerAddrSMTP: example: "smtp.gmail.com:587", see `popular_providers.go` for more examples,
+// with a development transport such as WithFileTransport it does not connect,
+// :arg providerAddrSMTP: example: "smtp.gmail.com:587", see Profiles for more examples,
 // :arg username: example: "daominahpublic@gmail.com"
-func NewSender(providerAddrSMTP string, username string, password string) (
-	*Sender, error) {
+func NewSender(providerAddrSMTP string, username string, password string,
+	options ...SenderOption) (*Sender, error) {
+	ret := &Sender{
+		providerAddrSMTP: providerAddrSMTP, username: username, password: password,
+		retry: NoRetry, limitPolicy: LimitFailFast,
+	}
+	if profile, found := profileForSMTP(providerAddrSMTP); found {
+		ret.limiter = newRateLimiter(profile.SendLimit)
+	}
+	profileLimiter := ret.limiter
+	for _, option := range options {
+		option(ret)
+	}
+	if ret.transport != nil {
+		if ret.limiter == profileLimiter {
+			ret.limiter = nil // nothing is sent to the provider
+		}
+		return ret, nil
+	}
 	words := strings.Split(providerAddrSMTP, ":")
 	if len(words) < 2 {
 		return nil, errors.New("unexpected bad server address")
 	}
-	host, port := words[0], words[1]
-	portInt, _ := strconv.Atoi(port)
-	mailer := gomail.NewDialer(host, portInt, username, password)
-	mailer.TLSConfig = nil
-	//mailer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-	ret := &Sender{
-		providerAddrSMTP: providerAddrSMTP, username: username, password: password,
-		mailer: mailer,
-	}
+	ret.host = words[0]
+	ret.port, _ = strconv.Atoi(words[1])
 	now := time.Now().UTC().Format(time.RFC3339Nano)
-	err := ret.SendMail(username, "initing Sender test "+now, TextPlain, now)
+	_, err := ret.sendMail(username, "initing Sender test "+now, TextPlain, now)
 	if err != nil {
 		return nil, err
 	}
 	return ret, nil
 }
 
+// Username returns the account that sends emails
+func (m Sender) Username() string {
+	return m.username
+}
+
 // SendMail sends an email,
 // this func opens a connection, sends the given emails and closes the connection,
+// temporary failures are retried according to the Sender's RetryPolicy,
+// returns a RateLimitError if the Sender's SendLimit is reached,
 // TODO: consider to reuse a persistent connection,
 // :arg contentType: can be TextPlain or TextHTML
 func (m Sender) SendMail(targetEmail string,
 	subject string, contentType MIMEType, content string) error {
+	data, err := m.sendMail(targetEmail, subject, contentType, content)
+	if err != nil {
+		return err
+	}
+	if m.sentCopy != nil {
+		if err := m.sentCopy.AppendSent(data); err != nil {
+			return &SentCopyError{Err: err}
+		}
+	}
+	return nil
+}
+
+// sendMail returns the sent RFC 5322 message
+func (m Sender) sendMail(targetEmail string,
+	subject string, contentType MIMEType, content string) ([]byte, error) {
 	msg := gomail.NewMessage()
 	msg.SetHeader("From", m.username)
 	msg.SetHeader("To", targetEmail)
 	msg.SetHeader("Subject", subject)
 	msg.SetBody(string(contentType), content)
-	err := m.mailer.DialAndSend(msg)
+	data := &bytes.Buffer{}
+	if _, err := msg.WriteTo(data); err != nil {
+		return nil, fmt.Errorf("render message: %v", err)
+	}
+	release, err := m.acquireSendSlot()
 	if err != nil {
-		return fmt.Errorf("send %v to %v: %v", m.username, targetEmail, err)
+		return nil, fmt.Errorf("send %v to %v: %w", m.username, targetEmail, err)
 	}
-	return nil
+	smtpMsg := smtpMessage{from: m.username, to: []string{targetEmail}, data: data.Bytes()}
+	if m.transport != nil {
+		err = m.transport.deliver(smtpMsg)
+	} else {
+		err = m.sendWithRetry(smtpMsg)
+	}
+	if err != nil {
+		var sendErr *SendError
+		if !errors.As(err, &sendErr) || !sendErr.MaybeDelivered {
+			release()
+		}
+		return nil, fmt.Errorf("send %v to %v: %w", m.username, targetEmail, err)
+	}
+	return data.Bytes(), nil
 }
 
 // MIMEType stands for Multipurpose Internet Mail Extensions,
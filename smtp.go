@@ -0,0 +1,188 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SendStage is the step of a SMTP dialogue where a send attempt failed
+type SendStage string
+
+// SendStage enum
+const (
+	StageDial     SendStage = "dial"     // TCP connect, TLS handshake, STARTTLS
+	StageAuth     SendStage = "auth"     // SMTP AUTH
+	StageEnvelope SendStage = "envelope" // MAIL FROM and RCPT TO
+	StageData     SendStage = "data"     // DATA command and writing the message
+	StageDataEnd  SendStage = "data end" // final dot, the server accepts or rejects here
+)
+
+// SendError is returned by a failed SMTP send attempt
+type SendError struct {
+	Stage SendStage
+	Err   error
+	// MaybeDelivered is true if the connection broke after the final dot of
+	// DATA had been written, the server may have accepted the message,
+	// so it must not be sent again
+	MaybeDelivered bool
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("smtp %v: %v", e.Stage, e.Err)
+}
+
+func (e *SendError) Unwrap() error { return e.Err }
+
+// Code returns the SMTP reply code if the server rejected the attempt,
+// returns 0 for network or local errors
+func (e *SendError) Code() int {
+	var protoErr *textproto.Error
+	if errors.As(e.Err, &protoErr) {
+		return protoErr.Code
+	}
+	return 0
+}
+
+// Temporary reports whether the attempt can be safely retried:
+// 4xx replies (greylisting, mailbox busy, ..) and broken connections
+// before the message could have been accepted
+func (e *SendError) Temporary() bool {
+	if e.MaybeDelivered {
+		return false
+	}
+	if code := e.Code(); code != 0 {
+		return code >= 400 && code < 500
+	}
+	if e.Err == io.EOF || e.Err == io.ErrUnexpectedEOF {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(e.Err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(e.Err, &netErr) {
+		return true // timeout, connection refused or reset
+	}
+	return false // TLS certificate, auth mechanism, ..
+}
+
+// smtpMessage is the envelope and the rendered bytes of an outgoing email,
+// the same bytes are used for every attempt
+type smtpMessage struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// sendSMTP makes one SMTP dialogue: dial, auth, envelope, data, quit,
+// a zero deadline means no limit for the whole dialogue
+func (m Sender) sendSMTP(msg smtpMessage, deadline time.Time) error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Deadline: deadline}
+	conn, err := dialer.Dial("tcp", fmt.Sprintf("%v:%v", m.host, m.port))
+	if err != nil {
+		return &SendError{Stage: StageDial, Err: err}
+	}
+	defer conn.Close()
+	if !deadline.IsZero() {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := m.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: m.host}
+	}
+	if m.port == 465 { // implicit TLS, other ports use STARTTLS if supported
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return &SendError{Stage: StageDial, Err: err}
+	}
+	if m.port != 465 {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return &SendError{Stage: StageDial, Err: err}
+			}
+		}
+	}
+	if ok, mechanisms := c.Extension("AUTH"); ok && m.username != "" {
+		if err := c.Auth(m.smtpAuth(mechanisms)); err != nil {
+			return &SendError{Stage: StageAuth, Err: err}
+		}
+	}
+
+	if err := c.Mail(msg.from); err != nil {
+		return &SendError{Stage: StageEnvelope, Err: err}
+	}
+	for _, to := range msg.to {
+		if err := c.Rcpt(to); err != nil {
+			return &SendError{Stage: StageEnvelope, Err: err}
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return &SendError{Stage: StageData, Err: err}
+	}
+	if _, err := w.Write(msg.data); err != nil {
+		// the final dot was not written so the server will discard
+		// the message when the deferred conn.Close happens
+		return &SendError{Stage: StageData, Err: err}
+	}
+	if err := w.Close(); err != nil {
+		var protoErr *textproto.Error
+		isRejected := errors.As(err, &protoErr)
+		return &SendError{Stage: StageDataEnd, Err: err, MaybeDelivered: !isRejected}
+	}
+	_ = c.Quit() // message was accepted, ignore errors while saying goodbye
+	return nil
+}
+
+// smtpAuth chooses an auth mechanism the same way as gomail.Dialer
+func (m Sender) smtpAuth(mechanisms string) smtp.Auth {
+	if strings.Contains(mechanisms, "CRAM-MD5") {
+		return smtp.CRAMMD5Auth(m.username, m.password)
+	}
+	if strings.Contains(mechanisms, "LOGIN") && !strings.Contains(mechanisms, "PLAIN") {
+		return &loginAuth{username: m.username, password: m.password, host: m.host}
+	}
+	return smtp.PlainAuth("", m.username, m.password, m.host)
+}
+
+// loginAuth implements the LOGIN authentication mechanism
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch {
+	case bytes.EqualFold(fromServer, []byte("Username:")):
+		return []byte(a.username), nil
+	case bytes.EqualFold(fromServer, []byte("Password:")):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
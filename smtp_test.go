@@ -0,0 +1,248 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer is a plain text SMTP server without AUTH for offline tests
+type fakeSMTPServer struct {
+	listener net.Listener
+	// reply can override the reply for a command of a session (count from 1),
+	// cmd is an upper case verb such as "MAIL", "RCPT", "DATA" or "." for
+	// the end of data, returns "" for the default reply or "DROP" to
+	// close the connection without replying
+	reply func(session int, cmd string) string
+
+	mutex    *sync.Mutex
+	sessions int
+	received [][]byte // data of accepted messages
+}
+
+func newFakeSMTPServer(t *testing.T,
+	reply func(session int, cmd string) string) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener, reply: reply, mutex: &sync.Mutex{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.sessions++
+			session := s.sessions
+			s.mutex.Unlock()
+			go s.serve(conn, session)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) sender() Sender {
+	return Sender{username: "tester@example.com",
+		host: "127.0.0.1", port: s.port(), retry: NoRetry}
+}
+
+func (s *fakeSMTPServer) countSessions() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sessions
+}
+
+func (s *fakeSMTPServer) receivedMessages() [][]byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]byte(nil), s.received...)
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn, session int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// respond returns false if the connection should be closed
+	respond := func(cmd string, defaultReply string) bool {
+		reply := ""
+		if s.reply != nil {
+			reply = s.reply(session, cmd)
+		}
+		if reply == "DROP" {
+			return false
+		}
+		if reply == "" {
+			reply = defaultReply
+		}
+		conn.Write([]byte(reply + "\r\n"))
+		return true
+	}
+	if !respond("CONNECT", "220 localhost fake ESMTP") {
+		return
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			if !respond(cmd, "250-localhost\r\n250 8BITMIME") {
+				return
+			}
+		case "QUIT":
+			respond(cmd, "221 bye")
+			return
+		case "DATA":
+			if !respond(cmd, "354 go ahead") {
+				return
+			}
+			data := &bytes.Buffer{}
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			reply := ""
+			if s.reply != nil {
+				reply = s.reply(session, ".")
+			}
+			if reply == "DROP" {
+				return
+			}
+			if reply == "" || strings.HasPrefix(reply, "2") {
+				s.mutex.Lock()
+				s.received = append(s.received, data.Bytes())
+				s.mutex.Unlock()
+			}
+			if reply == "" {
+				reply = "250 queued as " + strconv.Itoa(session)
+			}
+			conn.Write([]byte(reply + "\r\n"))
+		default:
+			if !respond(cmd, "250 ok") {
+				return
+			}
+		}
+	}
+}
+
+func TestSender_RetryGreylisting(t *testing.T) {
+	server := newFakeSMTPServer(t, func(session int, cmd string) string {
+		if session == 1 && cmd == "RCPT" {
+			return "451 4.7.1 greylisted, try again later"
+		}
+		return ""
+	})
+	sender := server.sender()
+	sender.retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	err := sender.SendMail("target@example.com", "subject0", TextPlain, "content0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := server.countSessions(); n != 2 {
+		t.Errorf("unexpected sessions: real %v, expected %v", n, 2)
+	}
+	received := server.receivedMessages()
+	if len(received) != 1 || !bytes.Contains(received[0], []byte("content0")) {
+		t.Errorf("unexpected received: %q", received)
+	}
+}
+
+func TestSender_RetryPermanentError(t *testing.T) {
+	server := newFakeSMTPServer(t, func(session int, cmd string) string {
+		if cmd == "RCPT" {
+			return "550 5.1.1 no such user"
+		}
+		return ""
+	})
+	sender := server.sender()
+	sender.retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	err := sender.SendMail("target@example.com", "subject0", TextPlain, "content0")
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sendErr.Stage != StageEnvelope || sendErr.Code() != 550 || sendErr.Temporary() {
+		t.Errorf("unexpected SendError: %#v", sendErr)
+	}
+	if n := server.countSessions(); n != 1 {
+		t.Errorf("unexpected sessions: real %v, expected %v", n, 1)
+	}
+}
+
+func TestSender_NoResendAfterDataEnd(t *testing.T) {
+	server := newFakeSMTPServer(t, func(session int, cmd string) string {
+		if cmd == "." {
+			return "DROP"
+		}
+		return ""
+	})
+	sender := server.sender()
+	sender.retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	err := sender.SendMail("target@example.com", "subject0", TextPlain, "content0")
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sendErr.MaybeDelivered || sendErr.Stage != StageDataEnd {
+		t.Errorf("unexpected SendError: %#v", sendErr)
+	}
+	if n := server.countSessions(); n != 1 {
+		t.Errorf("unexpected sessions: real %v, expected %v", n, 1)
+	}
+}
+
+func TestSender_RetryDataEndRejected(t *testing.T) {
+	server := newFakeSMTPServer(t, func(session int, cmd string) string {
+		if session == 1 && cmd == "." {
+			return "452 4.3.1 insufficient system storage"
+		}
+		return ""
+	})
+	sender := server.sender()
+	sender.retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	err := sender.SendMail("target@example.com", "subject0", TextPlain, "content0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(server.receivedMessages()); n != 1 {
+		t.Errorf("unexpected received: real %v, expected %v", n, 1)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, expected := range map[int]time.Duration{
+		1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second,
+		4: 5 * time.Second, 100: 5 * time.Second,
+	} {
+		if real := p.backoff(attempt); real != expected {
+			t.Errorf("backoff(%v): real %v, expected %v", attempt, real, expected)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if real := p.backoff(1); real < 500*time.Millisecond || real > 1500*time.Millisecond {
+			t.Errorf("backoff with jitter out of range: %v", real)
+		}
+	}
+}
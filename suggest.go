@@ -0,0 +1,232 @@
+package email
+
+import (
+	"context"
+	"strings"
+)
+
+// Suggestion is a likely correction of a mistyped address
+type Suggestion struct {
+	Address    string  // the corrected address
+	Domain     string  // the corrected domain
+	Confidence float64 // in (0, 1], higher is more likely
+}
+
+// SuggestAddress returns a correction if the address domain looks like a
+// typo of a domain in Domains, example: "x@gmial.com" suggests "x@gmail.com",
+// in the spirit of mailcheck.js: the full domain is compared first, then
+// the second level domain and the top level domain separately,
+// the distance counts a keyboard adjacent substitution as half an edit.
+// An address with invalid syntax has no suggestion, a second level domain
+// shorter than minTypoLabel is never corrected because short real domains
+// (ibm.com, hp.com) are a few edits from a popular one
+func SuggestAddress(address string) (Suggestion, bool) {
+	localPart, domain, err := splitAddress(address)
+	if err != nil || !isValidLocalPart(localPart) {
+		return Suggestion{}, false
+	}
+	domain = strings.ToLower(domain)
+	if strings.HasPrefix(domain, "[") || !isValidDomain(domain) {
+		return Suggestion{}, false
+	}
+	if isKnownDomain(domain) {
+		return Suggestion{}, false
+	}
+	if _, found := ProviderForAddress(address); found {
+		return Suggestion{}, false
+	}
+
+	suggested, distance := "", 0.0
+	if len(domain[:strings.Index(domain, ".")]) >= minTypoLabel {
+		suggested, distance = closestString(domain, Domains, 2)
+	}
+	if suggested == "" {
+		suggested, distance = suggestByParts(domain)
+	}
+	if suggested == "" || suggested == domain {
+		return Suggestion{}, false
+	}
+	// confidence is 1 for an identical domain and 0 at maxTypoRatio
+	confidence := 1 - distance/float64(len(suggested))/maxTypoRatio
+	if confidence <= 0 {
+		return Suggestion{}, false
+	}
+	return Suggestion{Address: localPart + "@" + suggested,
+		Domain: suggested, Confidence: confidence}, true
+}
+
+// SuggestAddress is like the package SuggestAddress but also returns no
+// suggestion if the address domain accepts email (has MX or A records),
+// a DNS failure keeps the suggestion
+func (v Validator) SuggestAddress(ctx context.Context, address string) (
+	Suggestion, bool) {
+	suggestion, found := SuggestAddress(address)
+	if !found {
+		return suggestion, false
+	}
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	if v.checkDNS(ctx, domain) == nil {
+		return Suggestion{}, false
+	}
+	return suggestion, true
+}
+
+const (
+	// minTypoLabel is the shortest second level domain that can be corrected
+	minTypoLabel = 4
+	// maxTypoRatio is the largest distance per character of the suggested
+	// domain, a larger distance is more likely a different domain than a typo
+	maxTypoRatio = 0.25
+)
+
+// suggestByParts corrects the second level domain and the top level domain
+// separately, example: "yahooo.co.uk" to "yahoo.co.uk", "gmail.con" to
+// "gmail.com", returns the sum of the parts distances
+func suggestByParts(domain string) (string, float64) {
+	dot := strings.Index(domain, ".")
+	if dot <= 0 || dot == len(domain)-1 {
+		return "", 0
+	}
+	sld, tld := domain[:dot], domain[dot+1:]
+	total := 0.0
+	if !knownTLDs[tld] {
+		closest, distance := closestString(tld, knownTLDList, 1)
+		if closest == "" {
+			return "", 0
+		}
+		tld, total = closest, total+distance
+	}
+	if !knownSLDs[sld] && len(sld) >= minTypoLabel {
+		closest, distance := closestString(sld, knownSLDList, 1.5)
+		if closest != "" && isKnownDomain(closest+"."+tld) {
+			sld, total = closest, total+distance
+		}
+	}
+	return sld + "." + tld, total
+}
+
+// knownSLDs and knownTLDs are the parts of Domains before and after
+// the first dot, example: "yahoo" and "co.uk"
+var knownSLDs, knownTLDs = splitDomains()
+var knownSLDList, knownTLDList = mapKeys(knownSLDs), mapKeys(knownTLDs)
+
+func splitDomains() (map[string]bool, map[string]bool) {
+	slds, tlds := make(map[string]bool), make(map[string]bool)
+	for _, tld := range []string{"com", "net", "org", "edu", "gov", "info",
+		"biz", "io", "co", "me", "us", "uk", "co.uk", "de", "fr", "ru", "jp", "vn"} {
+		tlds[tld] = true
+	}
+	for _, d := range Domains {
+		dot := strings.Index(d, ".")
+		slds[d[:dot]] = true
+		tlds[d[dot+1:]] = true
+	}
+	return slds, tlds
+}
+
+func mapKeys(m map[string]bool) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	return ret
+}
+
+// closestString returns the candidate with the smallest typoDistance if
+// the distance is at most maxDistance, ties go to the earlier candidate in
+// Domains order, which lists popular domains first
+func closestString(s string, candidates []string, maxDistance float64) (
+	string, float64) {
+	best, bestDistance := "", maxDistance+1
+	for _, c := range candidates {
+		d := typoDistance(s, c)
+		if d < bestDistance || d == bestDistance && domainRank(c) < domainRank(best) {
+			best, bestDistance = c, d
+		}
+	}
+	if bestDistance > maxDistance {
+		return "", 0
+	}
+	return best, bestDistance
+}
+
+// domainRank is the index of a domain (or its first part) in Domains
+func domainRank(s string) int {
+	for i, d := range Domains {
+		if d == s || strings.HasPrefix(d, s+".") || strings.HasSuffix(d, "."+s) {
+			return i
+		}
+	}
+	return len(Domains)
+}
+
+// typoDistance is the optimal string alignment distance (Damerau-Levenshtein
+// without repeated edits of a substring), substituting a keyboard neighbor
+// costs 0.5 and transposing adjacent characters costs 1
+func typoDistance(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]float64, len(ra)+1)
+	for i := range d {
+		d[i] = make([]float64, len(rb)+1)
+		d[i][0] = float64(i)
+	}
+	for j := 0; j <= len(rb); j++ {
+		d[0][j] = float64(j)
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			substitution := 1.0
+			if ra[i-1] == rb[j-1] {
+				substitution = 0
+			} else if isKeyboardNeighbor(ra[i-1], rb[j-1]) {
+				substitution = 0.5
+			}
+			d[i][j] = minFloat(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+substitution)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minFloat(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minFloat(first float64, others ...float64) float64 {
+	ret := first
+	for _, v := range others {
+		if v < ret {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// qwertyRows is a US keyboard layout, a row is shifted about half a key
+// to the right of the row above
+var qwertyRows = []string{"1234567890-", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// isKeyboardNeighbor reports whether 2 keys touch on a QWERTY keyboard
+func isKeyboardNeighbor(a rune, b rune) bool {
+	rowA, colA := keyPosition(a)
+	rowB, colB := keyPosition(b)
+	if rowA < 0 || rowB < 0 {
+		return false
+	}
+	switch rowB - rowA {
+	case 0:
+		return colB-colA == 1 || colA-colB == 1
+	case 1: // b is below a: below left and below right keys
+		return colB == colA || colB == colA-1
+	case -1:
+		return colA == colB || colA == colB-1
+	}
+	return false
+}
+
+func keyPosition(r rune) (int, int) {
+	for row, keys := range qwertyRows {
+		if col := strings.IndexRune(keys, r); col >= 0 {
+			return row, col
+		}
+	}
+	return -1, -1
+}
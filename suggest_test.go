@@ -0,0 +1,80 @@
+package email
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestSuggestAddress(t *testing.T) {
+	for address, expected := range map[string]string{
+		"x@gmial.com":      "x@gmail.com",
+		"x@gmail.con":      "x@gmail.com",
+		"x@gnail.com":      "x@gmail.com",
+		"x@hotmial.com":    "x@hotmail.com",
+		"x@hotmail.co":     "x@hotmail.com",
+		"x@yahooo.com":     "x@yahoo.com",
+		"x@yaho.co.uk":     "x@yahoo.co.uk",
+		"x@outlok.com":     "x@outlook.com",
+		"x@gmail.com":      "",
+		"x@zohomail.com":   "",
+		"x@mycompany.com":  "",
+		"x@abcdefghij.xyz": "",
+		// short real domains are not typos of popular ones
+		"x@ibm.com":  "",
+		"x@sap.com":  "",
+		"x@hp.com":   "",
+		"x@acme.com": "",
+		"x@meta.com": "",
+		// real domains of providers are not typos of other domains
+		"x@mail.de": "",
+		"x@live.nl": "",
+		// invalid syntax
+		"x@.com":        "",
+		"x@gmial..com":  "",
+		"@gmial.com":    "",
+		"x y@gmial.com": "",
+	} {
+		suggestion, found := SuggestAddress(address)
+		if found != (expected != "") || suggestion.Address != expected {
+			t.Errorf("SuggestAddress(%v): real %q %v, expected %q",
+				address, suggestion.Address, found, expected)
+		}
+		if found && (suggestion.Confidence <= 0 || suggestion.Confidence > 1) {
+			t.Errorf("SuggestAddress(%v): bad confidence %v", address, suggestion.Confidence)
+		}
+	}
+}
+
+func TestValidator_SuggestAddress(t *testing.T) {
+	v := Validator{Resolver: stubResolver{mx: map[string][]*net.MX{
+		"gmial.example": {{Host: "mx.gmial.example.", Pref: 10}},
+	}}}
+	ctx := context.Background()
+	if suggestion, found := v.SuggestAddress(ctx, "x@gmial.com"); !found ||
+		suggestion.Address != "x@gmail.com" {
+		t.Errorf("unexpected suggestion for a domain without MX: %v, %v", suggestion, found)
+	}
+	// a typo-like domain that accepts email is a real domain
+	v.Resolver.(stubResolver).mx["gmial.com"] = []*net.MX{{Host: "mx.gmial.com.", Pref: 10}}
+	if suggestion, found := v.SuggestAddress(ctx, "x@gmial.com"); found {
+		t.Errorf("unexpected suggestion for a domain with MX: %v", suggestion)
+	}
+}
+
+func TestTypoDistance(t *testing.T) {
+	for _, c := range []struct {
+		a, b     string
+		distance float64
+	}{
+		{"gmail", "gmail", 0},
+		{"gmial", "gmail", 1},   // transposition
+		{"gnail", "gmail", 0.5}, // n is next to m
+		{"gxail", "gmail", 1},
+		{"gmai", "gmail", 1},
+	} {
+		if d := typoDistance(c.a, c.b); d != c.distance {
+			t.Errorf("typoDistance(%v, %v): real %v, expected %v", c.a, c.b, d, c.distance)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// transport delivers rendered messages instead of SMTP, for development
+type transport interface {
+	deliver(msg smtpMessage) error
+}
+
+// WithFileTransport makes the Sender write each message as an .eml file
+// into dir instead of sending it, dir is created if it does not exist,
+// NewSender does not connect or send a test email
+func WithFileTransport(dir string) SenderOption {
+	return func(s *Sender) { s.transport = &fileTransport{dir: dir} }
+}
+
+// WithMboxTransport makes the Sender append each message to an mbox file
+// (see MboxWriter) instead of sending it, the file is created if it does
+// not exist, NewSender does not connect or send a test email
+func WithMboxTransport(path string) SenderOption {
+	return func(s *Sender) { s.transport = &mboxTransport{path: path} }
+}
+
+// WithWriterTransport makes the Sender write each message followed by an
+// empty line to w instead of sending it, example: os.Stdout,
+// NewSender does not connect or send a test email
+func WithWriterTransport(w io.Writer) SenderOption {
+	return func(s *Sender) { s.transport = &writerTransport{w: w} }
+}
+
+type fileTransport struct {
+	dir   string
+	mutex sync.Mutex
+	count int
+}
+
+func (t *fileTransport) deliver(msg smtpMessage) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return fmt.Errorf("create directory: %v", err)
+	}
+	t.mutex.Lock()
+	t.count++
+	// file names sort in sending order
+	name := fmt.Sprintf("%v_%06d.eml",
+		time.Now().UTC().Format("20060102T150405.000000000"), t.count)
+	t.mutex.Unlock()
+	if err := ioutil.WriteFile(filepath.Join(t.dir, name), msg.data, 0600); err != nil {
+		return fmt.Errorf("write eml: %v", err)
+	}
+	return nil
+}
+
+type mboxTransport struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func (t *mboxTransport) deliver(msg smtpMessage) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	file, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open mbox: %v", err)
+	}
+	err = NewMboxWriter(file).WriteMessage(
+		Message{From: msg.from, InternalDate: time.Now(), raw: msg.data})
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("close mbox: %v", closeErr)
+	}
+	return err
+}
+
+type writerTransport struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+func (t *writerTransport) deliver(msg smtpMessage) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, err := fmt.Fprintf(t.w, "%s\r\n", msg.data); err != nil {
+		return fmt.Errorf("write message: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package email
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSender_Transports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	emlDir := filepath.Join(dir, "outbox")
+	sender, err := NewSender("smtp.gmail.com:587", "dev@example.com", "",
+		WithFileTransport(emlDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subject := range []string{"first", "second"} {
+		err := sender.SendMail("friend@example.com", subject, TextHTML, "<b>hi</b>")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if quota := sender.RemainingQuota(); quota.RemainingDay != -1 {
+		t.Errorf("unexpected quota for a file transport: %#v", quota)
+	}
+	files, err := filepath.Glob(filepath.Join(emlDir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("unexpected eml files: %v, %v", files, err)
+	}
+	file, err := os.Open(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	msg, err := ParseMessage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "second" || msg.From != "dev@example.com" ||
+		msg.Body != "<b>hi</b>" || msg.Header.Get("To") != "friend@example.com" {
+		t.Errorf("unexpected eml message: %#v", msg)
+	}
+
+	mboxPath := filepath.Join(dir, "sent.mbox")
+	sender, err = NewSender("", "dev@example.com", "", WithMboxTransport(mboxPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subject := range []string{"first", "second"} {
+		if err := sender.SendMail("friend@example.com", subject, TextPlain, "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mbox, err := os.Open(mboxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mbox.Close()
+	msgs := readAll(t, NewMboxReader(mbox))
+	if len(msgs) != 2 || msgs[0].Subject != "first" || strings.TrimSpace(msgs[1].Body) != "hi" {
+		t.Errorf("unexpected mbox messages: %#v", msgs)
+	}
+
+	out := &bytes.Buffer{}
+	sender, err = NewSender("", "dev@example.com", "", WithWriterTransport(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMail("friend@example.com", "hello", TextPlain, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Subject: hello\r\n") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
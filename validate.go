@@ -0,0 +1,243 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ValidationLevel is a set of checks for ValidateAddress, combine with |,
+// RFC 5322 syntax with an ASCII domain is always checked
+type ValidationLevel uint
+
+// ValidationLevel enum
+const (
+	ValidateSyntax ValidationLevel = 0
+	// AllowIDN accepts internationalized domain names (such as "münchen.de"),
+	// they are converted to punycode ("xn--mnchen-3ya.de")
+	AllowIDN ValidationLevel = 1 << 0
+	// ValidateKnownDomain requires the domain to be in Domains or Profiles
+	ValidateKnownDomain ValidationLevel = 1 << 1
+	// ValidateDNS requires the domain to have MX records or, if it has no
+	// MX, an A or AAAA record (the implicit MX of RFC 5321)
+	ValidateDNS ValidationLevel = 1 << 2
+)
+
+// Address validation errors, a returned error wraps one of them
+var (
+	ErrInvalidSyntax = errors.New("invalid address syntax")
+	ErrUnknownDomain = errors.New("unknown domain")
+	ErrNoMailServer  = errors.New("domain does not accept email")
+)
+
+// Validator checks email addresses,
+// the zero value uses net.DefaultResolver
+type Validator struct {
+	Resolver Resolver
+}
+
+// ValidateAddress is Validator{}.Validate
+func ValidateAddress(ctx context.Context, address string, level ValidationLevel) (
+	string, error) {
+	return Validator{}.Validate(ctx, address, level)
+}
+
+// Validate returns the address with its domain lowercased and in ASCII
+// (punycode) form, or an error that wraps ErrInvalidSyntax,
+// ErrUnknownDomain or ErrNoMailServer, DNS failures are returned as is
+func (v Validator) Validate(ctx context.Context, address string,
+	level ValidationLevel) (string, error) {
+	localPart, domain, err := splitAddress(address)
+	if err != nil {
+		return "", err
+	}
+	if !isValidLocalPart(localPart) {
+		return "", fmt.Errorf("%w: bad local part %q", ErrInvalidSyntax, localPart)
+	}
+	asciiDomain, err := toASCIIDomain(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSyntax, err)
+	}
+	if asciiDomain != strings.ToLower(domain) && level&AllowIDN == 0 {
+		return "", fmt.Errorf("%w: internationalized domain %q", ErrInvalidSyntax, domain)
+	}
+	if !isValidDomain(asciiDomain) {
+		return "", fmt.Errorf("%w: bad domain %q", ErrInvalidSyntax, domain)
+	}
+	if len(localPart)+1+len(asciiDomain) > 254 {
+		return "", fmt.Errorf("%w: longer than 254 characters", ErrInvalidSyntax)
+	}
+	normalized := localPart + "@" + asciiDomain
+
+	if level&ValidateKnownDomain != 0 {
+		_, isProvider := ProviderForAddress(normalized)
+		if !isProvider && !isKnownDomain(asciiDomain) {
+			return "", fmt.Errorf("%w: %v", ErrUnknownDomain, asciiDomain)
+		}
+	}
+	if level&ValidateDNS != 0 && !strings.HasPrefix(asciiDomain, "[") {
+		if err := v.checkDNS(ctx, asciiDomain); err != nil {
+			return "", err
+		}
+	}
+	return normalized, nil
+}
+
+func (v Validator) checkDNS(ctx context.Context, domain string) error {
+	resolver := v.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	isNotFound := func(err error) bool {
+		var dnsErr *net.DNSError
+		return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+	}
+	records, err := resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("lookup MX %v: %v", domain, err)
+	}
+	if len(records) > 0 {
+		// RFC 7505 null MX: a single "." record means no email accepted
+		if len(records) == 1 && strings.TrimSuffix(records[0].Host, ".") == "" {
+			return fmt.Errorf("%w: null MX for %v", ErrNoMailServer, domain)
+		}
+		return nil
+	}
+	hosts, err := resolver.LookupHost(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("lookup host %v: %v", domain, err)
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("%w: no MX or A record for %v", ErrNoMailServer, domain)
+	}
+	return nil
+}
+
+// NormalizeAddress returns a canonical form for deduplicating accounts:
+// lowercase domain in ASCII form, googlemail.com becomes gmail.com,
+// for providers that ignore case and support plus addressing (such as
+// GMail, Outlook, ICloud) the local part is lowercased and "+tag" is
+// removed, for GMail dots in the local part are removed too
+func NormalizeAddress(address string) (string, error) {
+	normalized, err := ValidateAddress(context.Background(), address, AllowIDN)
+	if err != nil {
+		return "", err
+	}
+	at := strings.LastIndex(normalized, "@")
+	localPart, domain := normalized[:at], normalized[at+1:]
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	profile, _ := ProviderForAddress(normalized)
+	if plusAddressingProviders[profile.Provider] {
+		localPart = strings.ToLower(localPart)
+		if plus := strings.Index(localPart, "+"); plus > 0 {
+			localPart = localPart[:plus]
+		}
+	}
+	if profile.Provider == GMail {
+		localPart = strings.Replace(localPart, ".", "", -1)
+	}
+	return localPart + "@" + domain, nil
+}
+
+// plusAddressingProviders ignore the local part case and deliver
+// "name+tag@domain" to "name@domain"
+var plusAddressingProviders = map[Provider]bool{
+	GMail: true, Outlook: true, ICloud: true, Fastmail: true,
+	ZohoMail: true, Yandex: true,
+}
+
+func splitAddress(address string) (localPart string, domain string, err error) {
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 {
+		return "", "", fmt.Errorf("%w: missing local part or domain", ErrInvalidSyntax)
+	}
+	return address[:at], address[at+1:], nil
+}
+
+// isAtext reports whether r is allowed in a RFC 5322 dot-atom
+func isAtext(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		strings.ContainsRune("!#$%&'*+-/=?^_`{|}~", r)
+}
+
+// isValidLocalPart accepts a dot-atom or a quoted-string of at most 64 bytes
+func isValidLocalPart(localPart string) bool {
+	if localPart == "" || len(localPart) > 64 {
+		return false
+	}
+	if strings.HasPrefix(localPart, `"`) {
+		if len(localPart) < 2 || !strings.HasSuffix(localPart, `"`) {
+			return false
+		}
+		inner := localPart[1 : len(localPart)-1]
+		for i := 0; i < len(inner); i++ {
+			c := inner[i]
+			switch {
+			case c == '\\':
+				i++ // quoted-pair
+				if i >= len(inner) || inner[i] < 0x20 || inner[i] > 0x7e {
+					return false
+				}
+			case c == '"' || c < 0x20 || c > 0x7e:
+				return false
+			}
+		}
+		return true
+	}
+	for _, atom := range strings.Split(localPart, ".") {
+		if atom == "" { // leading, trailing or consecutive dots
+			return false
+		}
+		for _, r := range atom {
+			if !isAtext(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isValidDomain accepts an ASCII hostname with at least 2 labels or a
+// domain literal such as "[192.0.2.1]"
+func isValidDomain(domain string) bool {
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		literal := domain[1 : len(domain)-1]
+		literal = strings.TrimPrefix(literal, "IPv6:")
+		return net.ParseIP(literal) != nil
+	}
+	if len(domain) > 253 {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 ||
+			label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	return strings.Trim(tld, "0123456789") != "" // not all numeric
+}
+
+// toASCIIDomain maps the domain with IDNA (UTS #46) lookup rules, so it
+// is lowercased and normalized, and converts non-ASCII labels to A-labels
+func toASCIIDomain(domain string) (string, error) {
+	if strings.HasPrefix(domain, "[") { // domain literal
+		return domain, nil
+	}
+	return idna.Lookup.ToASCII(domain)
+}
@@ -0,0 +1,87 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	type testCase struct {
+		address  string
+		level    ValidationLevel
+		expected string // empty means invalid
+	}
+	for _, c := range []testCase{
+		{"daominahpublic@gmail.com", ValidateSyntax, "daominahpublic@gmail.com"},
+		{"Tung.Dao+tag@Example.COM", ValidateSyntax, "Tung.Dao+tag@example.com"},
+		{`"john doe"@example.com`, ValidateSyntax, `"john doe"@example.com`},
+		{"user@[192.0.2.1]", ValidateSyntax, "user@[192.0.2.1]"},
+		{"user@münchen.de", ValidateSyntax, ""},
+		{"user@münchen.de", AllowIDN, "user@xn--mnchen-3ya.de"},
+		{"user@bücher.example", AllowIDN, "user@xn--bcher-kva.example"},
+		{"user@例え.テスト", AllowIDN, "user@xn--r8jz45g.xn--zckzah"},
+		// UTS #46 mapping and normalization give the same A-label
+		{"user@MÜNCHEN.de", AllowIDN, "user@xn--mnchen-3ya.de"},
+		{"user@mu\u0308nchen.de", AllowIDN, "user@xn--mnchen-3ya.de"},
+		{"user@\u0300a.example", AllowIDN, ""}, // starts with a combining mark
+		{"user@\u0627b.example", AllowIDN, ""}, // breaks the bidi rule
+		{"user@xn--zz.example", AllowIDN, ""},  // invalid A-label
+		{"user@localhost", ValidateSyntax, ""},
+		{"user@-bad.com", ValidateSyntax, ""},
+		{"user@example.123", ValidateSyntax, ""},
+		{".user@example.com", ValidateSyntax, ""},
+		{"us..er@example.com", ValidateSyntax, ""},
+		{"user name@example.com", ValidateSyntax, ""},
+		{"@example.com", ValidateSyntax, ""},
+		{"user@", ValidateSyntax, ""},
+		{"user", ValidateSyntax, ""},
+		{"user@yahoo.co.jp", ValidateKnownDomain, "user@yahoo.co.jp"},
+		{"user@zohomail.com", ValidateKnownDomain, "user@zohomail.com"},
+		{"user@example.com", ValidateKnownDomain, ""},
+	} {
+		real, err := ValidateAddress(context.Background(), c.address, c.level)
+		if (err == nil) != (c.expected != "") || real != c.expected {
+			t.Errorf("ValidateAddress(%v, %v): real %q %v, expected %q",
+				c.address, c.level, real, err, c.expected)
+		}
+	}
+}
+
+func TestValidator_DNS(t *testing.T) {
+	v := Validator{Resolver: stubResolver{
+		mx: map[string][]*net.MX{
+			"mx.example":     {{Host: "mail.mx.example.", Pref: 10}},
+			"nullmx.example": {{Host: ".", Pref: 0}},
+		},
+		a: map[string][]string{"a.example": {"192.0.2.1"}},
+	}}
+	ctx := context.Background()
+	for _, address := range []string{"x@mx.example", "x@a.example"} {
+		if _, err := v.Validate(ctx, address, ValidateDNS); err != nil {
+			t.Errorf("Validate(%v): %v", address, err)
+		}
+	}
+	for _, address := range []string{"x@nullmx.example", "x@none.example"} {
+		if _, err := v.Validate(ctx, address, ValidateDNS); !errors.Is(err, ErrNoMailServer) {
+			t.Errorf("Validate(%v): unexpected error %v", address, err)
+		}
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	for address, expected := range map[string]string{
+		"Dao.Minh+news@GoogleMail.com": "daominh@gmail.com",
+		"d.a.o.minh@gmail.com":         "daominh@gmail.com",
+		"Someone+x@Outlook.com":        "someone@outlook.com",
+		"Some.One+x@Example.COM":       "Some.One+x@example.com",
+		"a.b+c@aol.com":                "a.b+c@aol.com",
+	} {
+		real, err := NormalizeAddress(address)
+		if err != nil || real != expected {
+			t.Errorf("NormalizeAddress(%v): real %v %v, expected %v",
+				address, real, err, expected)
+		}
+	}
+}
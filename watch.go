@@ -0,0 +1,316 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	imap "github.com/emersion/go-imap"
+)
+
+// EventType is the kind of change Watch reports
+type EventType string
+
+// EventType enum
+const (
+	// EventNewMessage is a message that arrived after Watch started
+	EventNewMessage EventType = "new"
+	// EventFlagsChanged is a change of flags of a watched message,
+	// needs WithFlagEvents
+	EventFlagsChanged EventType = "flags"
+	// EventExpunged is a watched message that was deleted or moved away,
+	// needs WithExpungeEvents
+	EventExpunged EventType = "expunged"
+	// EventError is a failed check, Watch keeps checking after it
+	EventError EventType = "error"
+)
+
+// Event is a change in the boxes of a Retriever, for EventFlagsChanged and
+// EventExpunged, Message has no Body if the message arrived before Watch
+// started, Message.Flags are the new flags
+type Event struct {
+	Type    EventType
+	Message Message
+	Err     error // only for EventError
+}
+
+// WatchOption customizes Watch
+type WatchOption func(*watchConfig)
+
+type watchConfig struct {
+	flagEvents    bool
+	expungeEvents bool
+}
+
+// WithFlagEvents makes Watch report flag changes of the messages that match
+// the filter, including the last 1000 messages of each box that arrived
+// before Watch started
+func WithFlagEvents() WatchOption {
+	return func(c *watchConfig) { c.flagEvents = true }
+}
+
+// WithExpungeEvents makes Watch report the deletion of the messages that
+// match the filter, including the last 1000 messages of each box that
+// arrived before Watch started
+func WithExpungeEvents() WatchOption {
+	return func(c *watchConfig) { c.expungeEvents = true }
+}
+
+// Watch checks inbox and spam every poll interval (see WithPollInterval) and
+// sends an event for each new message that matches the filter,
+// the returned channel is closed after the input context is cancelled
+func (r Retriever) Watch(ctx context.Context, filter SearchCriteria,
+	options ...WatchOption) <-chan Event {
+	config := &watchConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	events := make(chan Event, 100)
+	go func() {
+		defer close(events)
+		send := func(event Event) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		w := &watcher{r: r, filter: filter, config: config}
+		for i := 0; true; i++ {
+			if i > 0 {
+				timer := time.NewTimer(r.pollInterval)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+			changes, err := w.poll()
+			if err != nil {
+				changes = append(changes, Event{Type: EventError, Err: err})
+			}
+			for _, event := range changes {
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// WaitForMessages waits until n new messages that match the filter arrive,
+// returns the messages in arrival order or, if the input context is
+// cancelled, the messages so far and an error
+func (r Retriever) WaitForMessages(ctx context.Context, filter SearchCriteria,
+	n int) ([]Message, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ret := make([]Message, 0, n)
+	var lastErr error
+	for event := range r.Watch(ctx, filter) {
+		switch event.Type {
+		case EventError:
+			lastErr = event.Err
+		case EventNewMessage:
+			ret = append(ret, event.Message)
+			if len(ret) >= n {
+				return ret, nil
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	return ret, lastErr
+}
+
+// watcher keeps the state of Watch between polls
+type watcher struct {
+	r      Retriever
+	filter SearchCriteria
+	config *watchConfig
+
+	nextUIDs map[MailBox]uint32 // nil before the first poll
+	// watched messages for flag and expunge events
+	watched map[MailBox]map[uint32]Message
+}
+
+// poll returns the events since the last poll, the first poll only
+// takes a snapshot of the boxes
+func (w *watcher) poll() ([]Event, error) {
+	uidNexts, err := w.r.uidNexts()
+	if err != nil {
+		return nil, err
+	}
+	trackChanges := w.config.flagEvents || w.config.expungeEvents
+	if w.nextUIDs == nil {
+		w.watched = make(map[MailBox]map[uint32]Message)
+		if trackChanges {
+			for boxName := range uidNexts {
+				existing, err := w.r.watchedMessages(boxName, w.filter)
+				if err != nil {
+					return nil, err
+				}
+				w.watched[boxName] = existing
+			}
+		}
+		w.nextUIDs = uidNexts
+		return nil, nil
+	}
+
+	events := make([]Event, 0)
+	if trackChanges {
+		for boxName, watched := range w.watched {
+			if len(watched) == 0 {
+				continue
+			}
+			uids := make([]uint32, 0, len(watched))
+			for uid := range watched {
+				uids = append(uids, uid)
+			}
+			current, err := w.r.messageFlags(boxName, uids)
+			if err != nil {
+				return nil, err
+			}
+			for _, uid := range uids {
+				msg := watched[uid]
+				flags, found := current[uid]
+				switch {
+				case !found:
+					delete(watched, uid)
+					if w.config.expungeEvents {
+						events = append(events, Event{Type: EventExpunged, Message: msg})
+					}
+				case !equalFlags(msg.Flags, flags):
+					msg.Flags = flags
+					watched[uid] = msg
+					if w.config.flagEvents {
+						events = append(events, Event{Type: EventFlagsChanged, Message: msg})
+					}
+				}
+			}
+		}
+	}
+
+	// a box has new messages only if its UIDNEXT changed
+	minUIDs := make(map[MailBox]uint32)
+	for boxName, uidNext := range uidNexts {
+		if uidNext != w.nextUIDs[boxName] {
+			minUIDs[boxName] = w.nextUIDs[boxName]
+		}
+	}
+	if len(minUIDs) == 0 {
+		return events, nil
+	}
+	msgs, err := w.r.retrieveBoxes(w.filter, minUIDs, newFetchConfig(nil))
+	if err != nil {
+		return events, err
+	}
+	newMsgs := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		// a message that arrived during this poll is reported in the next
+		if msg.UID < uidNexts[msg.MailBox] {
+			newMsgs = append(newMsgs, msg)
+		}
+	}
+	sortByArrival(newMsgs)
+	for _, msg := range newMsgs {
+		events = append(events, Event{Type: EventNewMessage, Message: msg})
+		if trackChanges {
+			if w.watched[msg.MailBox] == nil {
+				w.watched[msg.MailBox] = make(map[uint32]Message)
+			}
+			w.watched[msg.MailBox][msg.UID] = msg
+		}
+	}
+	w.nextUIDs = uidNexts
+	return events, nil
+}
+
+// watchedMessages returns the last messages in the box that match the
+// filter (at most maxFetchedMessages), the messages have no Body
+func (r Retriever) watchedMessages(boxName MailBox, filter SearchCriteria) (
+	map[uint32]Message, error) {
+	boxClient, unlock, err := r.selectedClient(boxName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if _, err := boxClient.Select(r.boxNames[boxName], true); err != nil {
+		return nil, fmt.Errorf("select mail box: %v", err)
+	}
+	search, err := filter.imapCriteria(true)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := boxClient.UidSearch(search)
+	if err != nil {
+		return nil, fmt.Errorf("imap search request failed: %v", err)
+	}
+	ret := make(map[uint32]Message)
+	if len(uids) == 0 {
+		return ret, nil
+	}
+	if len(uids) > maxFetchedMessages {
+		uids = uids[len(uids)-maxFetchedMessages:]
+	}
+	imapMessages := make(chan *imap.Message, len(uids))
+	err = boxClient.UidFetch(uidSet(uids), []imap.FetchItem{imap.FetchUid, imap.FetchFlags,
+		imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchRFC822Size}, imapMessages)
+	if err != nil {
+		return nil, fmt.Errorf("imap fetch request failed: %v", err)
+	}
+	for imapMsg := range imapMessages {
+		msg := messageFromIMAP(boxName, imapMsg)
+		if !filter.matchTime(msg) {
+			continue
+		}
+		ret[msg.UID] = msg
+	}
+	return ret, nil
+}
+
+// messageFlags returns the flags of the messages with the UIDs that are
+// still in the box, only UID and FLAGS are fetched
+func (r Retriever) messageFlags(boxName MailBox, uids []uint32) (
+	map[uint32][]string, error) {
+	boxClient, unlock, err := r.selectedClient(boxName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if _, err := boxClient.Select(r.boxNames[boxName], true); err != nil {
+		return nil, fmt.Errorf("select mail box: %v", err)
+	}
+	imapMessages := make(chan *imap.Message, len(uids))
+	err = boxClient.UidFetch(uidSet(uids),
+		[]imap.FetchItem{imap.FetchUid, imap.FetchFlags}, imapMessages)
+	if err != nil {
+		return nil, fmt.Errorf("imap fetch request failed: %v", err)
+	}
+	ret := make(map[uint32][]string)
+	for imapMsg := range imapMessages {
+		ret[imapMsg.Uid] = imapMsg.Flags
+	}
+	return ret, nil
+}
+
+// equalFlags compares 2 flag lists ignoring order
+func equalFlags(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, flag := range a {
+		count[flag]++
+	}
+	for _, flag := range b {
+		if count[flag]--; count[flag] < 0 {
+			return false
+		}
+	}
+	return true
+}
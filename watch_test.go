@@ -0,0 +1,109 @@
+package email
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetriever_WaitForMessages(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	r := s.retriever(t, WithPollInterval(20*time.Millisecond))
+	now := time.Now()
+	added := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		err := s.appendMessage("INBOX", nil, now.Add(time.Second), "Subject: welcome\r\n\r\nhi")
+		if err == nil {
+			err = s.appendMessage("INBOX", nil, now.Add(2*time.Second), "Subject: ad\r\n\r\nbuy")
+		}
+		if err == nil {
+			time.Sleep(50 * time.Millisecond)
+			err = s.appendMessage("Spam", nil, now.Add(3*time.Second), "Subject: verify\r\n\r\n123")
+		}
+		added <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := SearchCriteria{Not: []SearchCriteria{{Subject: "ad"}}}
+	msgs, err := r.WaitForMessages(ctx, filter, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Subject != "welcome" || msgs[1].Subject != "verify" {
+		t.Errorf("unexpected messages: %#v", msgs)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	msgs, err = r.WaitForMessages(ctx, filter, 1)
+	if len(msgs) != 0 || err != context.DeadlineExceeded {
+		t.Errorf("unexpected result: %v, %v", msgs, err)
+	}
+}
+
+func TestRetriever_WatchChanges(t *testing.T) {
+	s := newFakeIMAPServer(t)
+	r := s.retriever(t, WithPollInterval(20*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	events := r.Watch(ctx, SearchCriteria{}, WithFlagEvents(), WithExpungeEvents())
+	next := func() Event {
+		select {
+		case event := <-events:
+			if event.Type == EventError {
+				t.Fatal(event.Err)
+			}
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for an event")
+		}
+		return Event{}
+	}
+
+	time.Sleep(50 * time.Millisecond) // let Watch take a snapshot
+	s.addMessage(t, "Spam", nil, time.Now(), "Subject: new\r\n\r\nhello")
+	if event := next(); event.Type != EventNewMessage ||
+		event.Message.Subject != "new" || event.Message.Body != "hello" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+
+	// the message in INBOX before Watch started
+	if err := r.AddFlags(Inbox, []uint32{6}, FlagFlagged); err != nil {
+		t.Fatal(err)
+	}
+	event := next()
+	if event.Type != EventFlagsChanged || event.Message.UID != 6 ||
+		!event.Message.HasFlag(FlagFlagged) {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+
+	if err := r.DeleteMessages(Spam, 1); err != nil {
+		t.Fatal(err)
+	}
+	for event = next(); event.Type == EventFlagsChanged; event = next() {
+		// \Deleted is set before the expunge
+	}
+	if event.Type != EventExpunged || event.Message.MailBox != Spam ||
+		event.Message.UID != 1 {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+
+	// without new messages, polls only check UIDNEXT and fetch FLAGS
+	searches := s.countCommands("UID SEARCH")
+	time.Sleep(100 * time.Millisecond)
+	if n := s.countCommands("UID SEARCH") - searches; n != 0 {
+		t.Errorf("unexpected searches without new messages: %v", n)
+	}
+	if !strings.Contains(s.log.String(), " UID FETCH 6 (UID FLAGS)\r\n") {
+		t.Errorf("expected polls to fetch only the flags of watched messages")
+	}
+
+	cancel()
+	for range events {
+	}
+}